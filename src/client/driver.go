@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	. "model"
+	"runtime/debug"
+)
+
+// driver calls one strategy instance for the game loop. It recovers from
+// panics in Move, replacing the move with an empty one, and disables the
+// strategy after too many consecutive panics.
+type driver struct {
+	cli *RemoteProcessClient
+	s   Strategy
+	wd  *watchdog
+
+	// ctx is the context of the current call when the strategy is a
+	// ContextMover, read by the innermost wrapper of the middleware chain.
+	ctx      context.Context
+	contexts bool
+
+	maxPanics int
+	panics    int
+	disabled  bool
+}
+
+// newDriver wraps s in the middlewares of opts. A ContextMover keeps
+// receiving its context through them, although they only call Move.
+func newDriver(cli *RemoteProcessClient, s Strategy, opts Options) *driver {
+	d := &driver{cli: cli, maxPanics: opts.MaxPanics}
+	if cm, ok := s.(ContextMover); ok {
+		d.contexts = true
+		s = Wrap(s, func(me *Player, world *World, game *Game, move *Move) {
+			cm.MoveContext(d.ctx, me, world, game, move)
+		})
+	}
+	d.s = chain(s, cli.logf, opts.Middleware)
+	if opts.TickBudget > 0 {
+		d.wd = &watchdog{call: d.call, budget: opts.TickBudget, policy: opts.LatePolicy}
+	}
+	return d
+}
+
+// busy reports whether a call from an earlier tick is still running, in
+// which case the next context must not be decoded into the one it reads.
+func (d *driver) busy() bool {
+	return d.wd != nil && d.wd.busy()
+}
+
+// move returns the move for pc. The strategy's context, if it takes one, is
+// derived from ctx and cancelled when the tick budget runs out.
+func (d *driver) move(ctx context.Context, pc *PlayerContext, g *Game) *Move {
+	if d.disabled {
+		return newMove()
+	}
+
+	var (
+		m    *Move
+		err  error
+		tick = pc.World.TickIndex
+	)
+
+	if d.wd != nil {
+		var late bool
+		if m, late, err = d.wd.move(ctx, pc, g); late {
+			d.cli.logf(LogInfo, "tick %d: strategy exceeded the %v budget, sending an empty move", tick, d.wd.budget)
+		}
+	} else {
+		m, err = d.call(ctx, pc, g)
+	}
+
+	if err == nil {
+		d.panics = 0
+		return m
+	}
+
+	d.panics++
+	d.cli.logf(LogError, "tick %d: %v", tick, err)
+
+	if d.maxPanics > 0 && d.panics >= d.maxPanics {
+		d.disabled = true
+		d.cli.logf(LogError, "tick %d: strategy disabled after %d consecutive panics", tick, d.panics)
+	}
+
+	return m
+}
+
+// call runs the strategy once, on its own goroutine under a watchdog. The
+// context handed to a ContextMover ends with the call.
+func (d *driver) call(ctx context.Context, pc *PlayerContext, g *Game) (*Move, error) {
+	if !d.contexts {
+		return callMove(d.s, pc, g)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.ctx = ctx
+	return callMove(d.s, pc, g)
+}
+
+// start calls the GameStarter hook of the strategy, if it has one.
+func (d *driver) start(g *Game, teamSize int) {
+	if err := startGame(d.s, g, teamSize); err != nil {
+		d.cli.logf(LogError, "game start: %v", err)
+	}
+}
+
+// end calls the GameEnder hook of the strategy, if it has one, once any
+// late Move has returned.
+func (d *driver) end(w *World) {
+	if d.wd != nil && d.wd.busy() {
+		if !d.wd.wait() {
+			d.cli.logf(LogError, "game end: strategy is still busy, skipping End")
+			return
+		}
+	}
+	if err := endGame(d.s, w); err != nil {
+		d.cli.logf(LogError, "game end: %v", err)
+	}
+}
+
+// report logs a summary of the ticks the strategy did not handle.
+func (d *driver) report() {
+	if d.wd != nil && d.wd.late > 0 {
+		d.cli.logf(LogInfo, "%d ticks exceeded the %v budget", d.wd.late, d.wd.budget)
+	}
+}
+
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("strategy panicked: %v\n%s", e.value, e.stack)
+}
+
+func startGame(s Strategy, g *Game, teamSize int) error {
+	if gs, ok := s.(GameStarter); ok {
+		return protect(func() { gs.Start(g, teamSize) })
+	}
+	return nil
+}
+
+func endGame(s Strategy, w *World) error {
+	if ge, ok := s.(GameEnder); ok {
+		return protect(func() { ge.End(w, scores(w)) })
+	}
+	return nil
+}
+
+func scores(w *World) map[int64]int {
+	m := make(map[int64]int, len(w.Players))
+	for _, p := range w.Players {
+		m[p.Id] = p.Score
+	}
+	return m
+}
+
+// protect calls f and returns a panic in it as an error.
+func protect(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{value: r, stack: debug.Stack()}
+		}
+	}()
+
+	f()
+	return nil
+}
+
+// callMove runs s.Move on a fresh move. If it panics, the panic is returned
+// as an error together with an empty move.
+func callMove(s Strategy, pc *PlayerContext, g *Game) (*Move, error) {
+	m := newMove()
+	if err := protect(func() { s.Move(pc.Player, pc.World, g, m) }); err != nil {
+		return newMove(), err
+	}
+	return m, nil
+}
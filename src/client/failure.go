@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrDisconnected marks errors caused by the server closing or
+	// resetting the connection before the game was over.
+	ErrDisconnected = errors.New("disconnected from the server")
+	// ErrProtocol marks errors caused by data from the server that does not
+	// follow the protocol, such as a message out of place.
+	ErrProtocol = errors.New("protocol violation")
+)
+
+// Exit codes of Start, StartTeam and their WithOptions variants.
+const (
+	ExitFailure      = 1
+	ExitUsage        = 2
+	ExitDisconnected = 3
+	ExitProtocol     = 4
+	ExitInterrupted  = 5
+)
+
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrDisconnected):
+		return ExitDisconnected
+	case errors.Is(err, ErrProtocol):
+		return ExitProtocol
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	}
+	return ExitFailure
+}
+
+// classify wraps err in ErrDisconnected or ErrProtocol when it is one of
+// them, keeping the original error in the chain.
+func classify(err error) error {
+	var pe *ProtocolError
+	var ne net.Error
+	switch {
+	case err == nil, errors.Is(err, ErrDisconnected), errors.Is(err, ErrProtocol):
+		return err
+	case disconnected(err):
+		return fmt.Errorf("%w: %w", ErrDisconnected, err)
+	case errors.As(err, &pe) && !errors.As(err, &ne):
+		return fmt.Errorf("%w: %w", ErrProtocol, err)
+	}
+	return err
+}
+
+func disconnected(err error) bool {
+	for _, target := range []error{
+		io.EOF, io.ErrUnexpectedEOF, io.ErrClosedPipe, net.ErrClosed,
+		syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// historySize is twice the decoder buffer: the bytes the decoder has not
+// consumed yet never push out those just before its position.
+const historySize = 1 << 17
+
+// history is a reader keeping the last bytes read through it, so that the
+// bytes around a decoding failure can be shown.
+type history struct {
+	r   io.Reader
+	buf [historySize]byte
+	n   int64
+}
+
+func (h *history) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	for b := p[:n]; len(b) > 0; {
+		c := copy(h.buf[h.n%historySize:], b)
+		h.n += int64(c)
+		b = b[c:]
+	}
+	return n, err
+}
+
+// window returns the bytes from offset from up to offset to that are still
+// held, and the offset of the first of them.
+func (h *history) window(from, to int64) ([]byte, int64) {
+	from = max(from, h.n-historySize, 0)
+	to = min(to, h.n)
+	if from >= to {
+		return nil, from
+	}
+	b := make([]byte, 0, to-from)
+	for i := from; i < to; {
+		j := i % historySize
+		c := min(to-i, historySize-j)
+		b = append(b, h.buf[j:j+c]...)
+		i += c
+	}
+	return b, from
+}
+
+// dumpContext is the number of bytes shown on each side of a failure.
+const dumpContext = 64
+
+// dump formats the bytes received around offset, 16 per line after their
+// offset, with the byte at offset marked.
+func (c *RemoteProcessClient) dump(offset int64) string {
+	if c.hist == nil {
+		return ""
+	}
+	start := offset - offset%16 - dumpContext
+	b, from := c.hist.window(start, offset+dumpContext)
+
+	var sb strings.Builder
+	for i := 0; i < len(b); i += 16 {
+		fmt.Fprintf(&sb, "%8d ", from+int64(i))
+		for j, x := range b[i:min(i+16, len(b))] {
+			mark := ' '
+			if from+int64(i+j) == offset {
+				mark = '>'
+			}
+			fmt.Fprintf(&sb, "%c%02x", mark, x)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
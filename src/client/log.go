@@ -0,0 +1,47 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+type LogLevel int
+
+const (
+	LogQuiet LogLevel = iota
+	LogError
+	LogInfo
+	LogDebug
+)
+
+var logLevelNames = [...]string{
+	LogQuiet: "quiet",
+	LogError: "error",
+	LogInfo:  "info",
+	LogDebug: "debug",
+}
+
+func (l LogLevel) String() string {
+	if l >= 0 && int(l) < len(logLevelNames) {
+		return logLevelNames[l]
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Set implements flag.Value.
+func (l *LogLevel) Set(s string) error {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			*l = LogLevel(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log level %q", s)
+}
+
+func (c *RemoteProcessClient) logf(level LogLevel, format string, args ...interface{}) {
+	if level <= c.level {
+		log.Printf(format, args...)
+	}
+}
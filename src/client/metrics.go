@@ -0,0 +1,179 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// Metrics accumulates, per tick, the time spent in each phase of the
+// client loop, summed over the members of a team:
+//
+//	Wait    blocked reading from the server
+//	Decode  decoding the contexts, the rest of the time spent reading them
+//	Move    in the strategies
+//	Write   encoding and flushing the moves
+type Metrics struct {
+	Wait, Decode, Move, Write Histogram
+}
+
+func (m *Metrics) String() string {
+	return fmt.Sprintf("wait %v; decode %v; move %v; write %v", &m.Wait, &m.Decode, &m.Move, &m.Write)
+}
+
+// Histogram keeps every sample, which is affordable for the few thousand
+// ticks of a game and gives exact quantiles.
+type Histogram struct {
+	samples []time.Duration
+	sorted  bool
+}
+
+func (h *Histogram) Add(d time.Duration) {
+	h.samples = append(h.samples, d)
+	h.sorted = false
+}
+
+func (h *Histogram) Len() int {
+	return len(h.samples)
+}
+
+// Quantile returns the sample below which a fraction q of the samples
+// fall, or zero for an empty histogram.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if len(h.samples) == 0 {
+		return 0
+	}
+	if !h.sorted {
+		slices.Sort(h.samples)
+		h.sorted = true
+	}
+	i := int(q * float64(len(h.samples)-1))
+	return h.samples[min(max(i, 0), len(h.samples)-1)]
+}
+
+func (h *Histogram) Max() time.Duration {
+	return h.Quantile(1)
+}
+
+func (h *Histogram) String() string {
+	return fmt.Sprintf("p50 %v p95 %v max %v", h.Quantile(.5), h.Quantile(.95), h.Max())
+}
+
+// meter measures the phases of each tick into Metrics and, optionally, a
+// CSV file with one line per tick. It sits between the connection and the
+// decoder to tell time blocked on the server from decoding time. The
+// methods called from the game loop do nothing on a nil meter.
+type meter struct {
+	r       io.Reader
+	blocked time.Duration
+
+	m *Metrics
+
+	w      *bufio.Writer
+	closer io.Closer
+
+	start                     time.Time
+	wait, decode, move, write time.Duration
+}
+
+func newMeter(m *Metrics) *meter {
+	if m == nil {
+		m = new(Metrics)
+	}
+	return &meter{m: m}
+}
+
+func (m *meter) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := m.r.Read(p)
+	m.blocked += time.Since(start)
+	return n, err
+}
+
+// createCSV makes the meter write the phases of every tick to path.
+func (m *meter) createCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	m.w = bufio.NewWriter(f)
+	m.closer = f
+	_, err = m.w.WriteString("tick,wait_us,decode_us,move_us,write_us\n")
+	return err
+}
+
+// startRead and endRead bracket the reading of a context, startMove,
+// startWrite and endWrite the handling of a move.
+func (m *meter) startRead() {
+	if m == nil {
+		return
+	}
+	m.blocked = 0
+	m.start = time.Now()
+}
+
+func (m *meter) endRead() {
+	if m == nil {
+		return
+	}
+	d := time.Since(m.start)
+	m.wait += m.blocked
+	m.decode += d - m.blocked
+}
+
+func (m *meter) startMove() {
+	if m == nil {
+		return
+	}
+	m.start = time.Now()
+}
+
+func (m *meter) startWrite() {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	m.move += now.Sub(m.start)
+	m.start = now
+}
+
+func (m *meter) endWrite() {
+	if m == nil {
+		return
+	}
+	m.write += time.Since(m.start)
+}
+
+// endTick records the phases of the tick and starts a new one.
+func (m *meter) endTick(tick int) error {
+	if m == nil {
+		return nil
+	}
+	m.m.Wait.Add(m.wait)
+	m.m.Decode.Add(m.decode)
+	m.m.Move.Add(m.move)
+	m.m.Write.Add(m.write)
+
+	var err error
+	if m.w != nil {
+		_, err = fmt.Fprintf(m.w, "%d,%d,%d,%d,%d\n", tick,
+			m.wait.Microseconds(), m.decode.Microseconds(), m.move.Microseconds(), m.write.Microseconds())
+	}
+
+	m.wait, m.decode, m.move, m.write = 0, 0, 0, 0
+	return err
+}
+
+func (m *meter) Close() error {
+	if m.w == nil {
+		return nil
+	}
+	err := m.w.Flush()
+	if cerr := m.closer.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
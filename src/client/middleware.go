@@ -0,0 +1,253 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	. "model"
+	"time"
+)
+
+// Middleware wraps a strategy, typically to act before or after its Move.
+// Middlewares registered in Options.Middleware are applied to every
+// strategy instance the client drives, the first one outermost. Those of
+// this package log through the client, at its LogLevel, and with the
+// standard logger when used outside of it.
+type Middleware func(next Strategy) Strategy
+
+// Chain wraps s in mw, the first middleware outermost.
+func Chain(s Strategy, mw ...Middleware) Strategy {
+	return chain(s, nil, mw)
+}
+
+// chain is Chain, also making the middlewares built on Wrap log with logf.
+func chain(s Strategy, logf logFunc, mw []Middleware) Strategy {
+	for i := len(mw) - 1; i >= 0; i-- {
+		s = mw[i](s)
+		if w, ok := s.(*wrapped); ok && logf != nil {
+			w.log = logf
+		}
+	}
+	return s
+}
+
+type logFunc func(level LogLevel, format string, args ...interface{})
+
+// MoveFunc has the signature of Strategy.Move.
+type MoveFunc func(me *Player, world *World, game *Game, move *Move)
+
+// Wrap returns a strategy whose Move is move and which forwards Start and
+// End to next, so that wrapping does not hide the optional GameStarter and
+// GameEnder interfaces. Middlewares should build on it.
+func Wrap(next Strategy, move MoveFunc) Strategy {
+	return &wrapped{next: next, move: move}
+}
+
+type wrapped struct {
+	next Strategy
+	move MoveFunc
+	// start and end, if set, run after those of next.
+	start func(game *Game, teamSize int)
+	end   func(world *World, scores map[int64]int)
+	// log, if set, filters messages by level.
+	log logFunc
+}
+
+func (w *wrapped) logf(level LogLevel, format string, args ...interface{}) {
+	if w.log != nil {
+		w.log(level, format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func (w *wrapped) Move(me *Player, world *World, game *Game, move *Move) {
+	w.move(me, world, game, move)
+}
+
+func (w *wrapped) Start(game *Game, teamSize int) {
+	if s, ok := w.next.(GameStarter); ok {
+		s.Start(game, teamSize)
+	}
+	if w.start != nil {
+		w.start(game, teamSize)
+	}
+}
+
+func (w *wrapped) End(world *World, scores map[int64]int) {
+	if e, ok := w.next.(GameEnder); ok {
+		e.End(world, scores)
+	}
+	if w.end != nil {
+		w.end(world, scores)
+	}
+}
+
+// Timing logs every Move that takes longer than slow, and the number of
+// calls with their mean and maximum duration at the end of the game.
+func Timing(slow time.Duration) Middleware {
+	return func(next Strategy) Strategy {
+		var (
+			calls          int
+			total, longest time.Duration
+		)
+
+		w := &wrapped{next: next}
+		w.move = func(me *Player, world *World, game *Game, move *Move) {
+			start := time.Now()
+			next.Move(me, world, game, move)
+			d := time.Since(start)
+
+			calls++
+			total += d
+			if d > longest {
+				longest = d
+			}
+			if slow > 0 && d > slow {
+				w.logf(LogInfo, "tick %d: Move took %v", world.TickIndex, d)
+			}
+		}
+		w.end = func(*World, map[int64]int) {
+			if calls > 0 {
+				w.logf(LogInfo, "%d moves, mean %v, max %v", calls, total/time.Duration(calls), longest)
+			}
+		}
+		return w
+	}
+}
+
+// LogMoves logs every move other than Action_None.
+func LogMoves(next Strategy) Strategy {
+	w := &wrapped{next: next}
+	w.move = func(me *Player, world *World, game *Game, move *Move) {
+		next.Move(me, world, game, move)
+		if move.Action != Action_None {
+			w.logf(LogInfo, "tick %d: %+v", world.TickIndex, *move)
+		}
+	}
+	return w
+}
+
+// SuppressInvalid replaces moves that ValidateMove rejects with empty ones,
+// logging why. The server ignores such moves anyway but still counts them
+// against the action limit.
+func SuppressInvalid(next Strategy) Strategy {
+	w := &wrapped{next: next}
+	w.move = func(me *Player, world *World, game *Game, move *Move) {
+		next.Move(me, world, game, move)
+		if err := ValidateMove(move, game); err != nil {
+			w.logf(LogInfo, "tick %d: suppressed invalid move: %v", world.TickIndex, err)
+			*move = *newMove()
+		}
+	}
+	return w
+}
+
+// ValidateMove checks the parameters of m against the ranges documented
+// on Move, for the action it sets.
+func ValidateMove(m *Move, g *Game) error {
+	if err := validateMove(m, g); err != nil {
+		return fmt.Errorf("action %d: %w", m.Action, err)
+	}
+	return nil
+}
+
+func validateMove(m *Move, g *Game) error {
+	w, h := g.WorldWidth, g.WorldHeight
+
+	if m.Type != Vehicle_None && m.Type > Vehicle_Tank {
+		return fmt.Errorf("unknown vehicle type %d", m.Type)
+	}
+
+	switch m.Action {
+	case Action_None:
+		return nil
+
+	case Action_ClearAndSelect, Action_AddToSelection, Action_Deselect:
+		if m.Group != 0 {
+			return checkGroup(m, g)
+		}
+		if err := check("Left", m.Left, 0, m.Right); err != nil {
+			return err
+		}
+		if err := check("Right", m.Right, m.Left, w); err != nil {
+			return err
+		}
+		if err := check("Top", m.Top, 0, m.Bottom); err != nil {
+			return err
+		}
+		return check("Bottom", m.Bottom, m.Top, h)
+
+	case Action_Assign, Action_Dismiss, Action_Disband:
+		return checkGroup(m, g)
+
+	case Action_Move:
+		if err := check("X", m.X, -w, w); err != nil {
+			return err
+		}
+		if err := check("Y", m.Y, -h, h); err != nil {
+			return err
+		}
+		return check("MaxSpeed", m.MaxSpeed, 0, math.MaxFloat64)
+
+	case Action_Rotate:
+		if err := check("X", m.X, -w, 2*w); err != nil {
+			return err
+		}
+		if err := check("Y", m.Y, -h, 2*h); err != nil {
+			return err
+		}
+		if err := check("Angle", m.Angle, -math.Pi, math.Pi); err != nil {
+			return err
+		}
+		if err := check("MaxSpeed", m.MaxSpeed, 0, math.MaxFloat64); err != nil {
+			return err
+		}
+		return check("MaxAngularSpeed", m.MaxAngularSpeed, 0, math.Pi)
+
+	case Action_Scale:
+		if err := check("X", m.X, -w, 2*w); err != nil {
+			return err
+		}
+		if err := check("Y", m.Y, -h, 2*h); err != nil {
+			return err
+		}
+		if err := check("Factor", m.Factor, 0.1, 10); err != nil {
+			return err
+		}
+		return check("MaxSpeed", m.MaxSpeed, 0, math.MaxFloat64)
+
+	case Action_SetupVehicleProduction:
+		if m.FacilityId < 0 {
+			return errors.New("FacilityId not set")
+		}
+		return nil
+
+	case Action_TacticalNuclearStrike:
+		if m.VehicleId < 0 {
+			return errors.New("VehicleId not set")
+		}
+		if err := check("X", m.X, 0, w); err != nil {
+			return err
+		}
+		return check("Y", m.Y, 0, h)
+
+	default:
+		return errors.New("unknown action")
+	}
+}
+
+func checkGroup(m *Move, g *Game) error {
+	if m.Group < 1 || m.Group > g.MaxUnitGroup {
+		return fmt.Errorf("Group %d out of [1, %d]", m.Group, g.MaxUnitGroup)
+	}
+	return nil
+}
+
+func check(field string, v, lo, hi float64) error {
+	if !(v >= lo && v <= hi) {
+		return fmt.Errorf("%s %g out of [%g, %g]", field, v, lo, hi)
+	}
+	return nil
+}
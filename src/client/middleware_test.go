@@ -0,0 +1,62 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"mockserver"
+	. "model"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// invalid moves at a negative speed, which SuppressInvalid rejects.
+type invalid struct{}
+
+func (invalid) Move(me *Player, world *World, game *Game, move *Move) {
+	move.Action, move.MaxSpeed = Action_Move, -1
+}
+
+// TestMiddlewareLogLevel plays a short game through the logging
+// middlewares and checks that they follow the client's log level.
+func TestMiddlewareLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	for _, level := range []LogLevel{LogQuiet, LogInfo} {
+		buf.Reset()
+
+		me := &Player{Id: 1, Me: true}
+		scenario := &mockserver.Scenario{TeamSize: 1, Game: &Game{TickCount: 2}}
+		for tick := 0; tick < 2; tick++ {
+			scenario.Ticks = append(scenario.Ticks, []*PlayerContext{{Player: me, World: &World{TickIndex: tick, Players: []*Player{me}}}})
+		}
+		srv, err := mockserver.Listen("127.0.0.1:0", scenario)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.Serve()
+
+		opts := DefaultOptions()
+		opts.Host, opts.Port, _ = net.SplitHostPort(srv.Addr().String())
+		opts.LogLevel = level
+		opts.Middleware = []Middleware{Timing(time.Nanosecond), LogMoves, SuppressInvalid}
+		err = Run(context.Background(), invalid{}, opts)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.String()
+		switch {
+		case level == LogQuiet && out != "":
+			t.Errorf("quiet: logged %q", out)
+		case level == LogInfo && !strings.Contains(out, "suppressed invalid move"):
+			t.Errorf("info: no suppressed move in %q", out)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package client
+
+import (
+	"codec"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Options configures how the client connects to the game server.
+type Options struct {
+	Host  string
+	Port  string
+	Token string
+
+	// Transport is a URL accepted by DialURL. When set, it replaces Host
+	// and Port.
+	Transport string
+	// Conn, when set, is used as the connection to the server instead of
+	// dialing one, e.g. an end of net.Pipe.
+	Conn io.ReadWriteCloser
+
+	// ConnectTimeout bounds a single dial attempt; zero means no timeout.
+	ConnectTimeout time.Duration
+	// Retries is the number of additional dial attempts made after the first
+	// one fails, RetryDelay is the pause between them.
+	Retries    int
+	RetryDelay time.Duration
+
+	LogLevel LogLevel
+
+	// RecordPath, when set, names the session file receiving a copy of all
+	// protocol traffic.
+	RecordPath string
+
+	// Limits overrides the bounds on list lengths accepted from the server,
+	// which are otherwise derived from the Game.
+	Limits codec.Limits
+
+	// TickBudget, when positive, bounds the time Strategy.Move may take per
+	// tick; an empty move is sent for ticks that overrun it and LatePolicy
+	// decides what becomes of the late result.
+	TickBudget time.Duration
+	LatePolicy LatePolicy
+
+	// Pooled makes the client reuse the VehicleUpdate structs and their
+	// Groups from one tick to the next. World.VehicleUpdates is then only
+	// valid until the strategy returns from Move.
+	Pooled bool
+
+	// Metrics, when set, receives the time spent in each phase of every
+	// tick. MetricsPath names a CSV file receiving the same per tick; the
+	// summary is logged at the end of the game when either is set.
+	Metrics     *Metrics
+	MetricsPath string
+
+	// Trace, when enabled, logs every field exchanged during its ticks with
+	// its offset and raw bytes.
+	Trace TickRange
+
+	// ProtocolVersion is the protocol version announced to the server and
+	// used to decode its messages; zero means codec.Version.
+	ProtocolVersion int
+
+	// Strategy names a registered strategy which replaces the one passed to
+	// Start, StartTeam or their WithOptions variants; see Register.
+	// ListStrategies makes them print the registered names and exit instead.
+	Strategy       string
+	ListStrategies bool
+
+	// Plugin names a strategy plugin whose factory replaces the strategy
+	// passed to Start, StartTeam or their WithOptions variants; see
+	// LoadPlugin.
+	Plugin string
+
+	// Middleware wraps every strategy instance, the first one outermost.
+	Middleware []Middleware
+
+	// MaxPanics, when positive, disables the strategy after that many
+	// consecutive panics in Move; empty moves are sent from then on.
+	MaxPanics int
+}
+
+// Environment variables consulted by ParseOptions.
+const (
+	EnvHost           = "CODEWARS_HOST"
+	EnvPort           = "CODEWARS_PORT"
+	EnvToken          = "CODEWARS_TOKEN"
+	EnvTransport      = "CODEWARS_TRANSPORT"
+	EnvConnectTimeout = "CODEWARS_CONNECT_TIMEOUT"
+	EnvRetries        = "CODEWARS_RETRIES"
+	EnvRetryDelay     = "CODEWARS_RETRY_DELAY"
+	EnvLogLevel       = "CODEWARS_LOG_LEVEL"
+	EnvRecord         = "CODEWARS_RECORD"
+	EnvTickBudget     = "CODEWARS_TICK_BUDGET"
+	EnvLatePolicy     = "CODEWARS_LATE_POLICY"
+	EnvMaxPanics      = "CODEWARS_MAX_PANICS"
+	EnvProtocol       = "CODEWARS_PROTOCOL_VERSION"
+	EnvTrace          = "CODEWARS_TRACE"
+	EnvPooled         = "CODEWARS_POOLED"
+	EnvMetrics        = "CODEWARS_METRICS"
+	EnvPlugin         = "CODEWARS_PLUGIN"
+	EnvStrategy       = "CODEWARS_STRATEGY"
+)
+
+// DefaultOptions returns the settings of the local-runner.
+func DefaultOptions() Options {
+	return Options{
+		Host:            "127.0.0.1",
+		Port:            "31001",
+		Token:           "0000000000000000",
+		ConnectTimeout:  10 * time.Second,
+		RetryDelay:      time.Second,
+		LogLevel:        LogInfo,
+		ProtocolVersion: codec.Version,
+	}
+}
+
+func (o Options) Address() string {
+	return o.Host + ":" + o.Port
+}
+
+// Target describes what the client connects to: the transport URL, or a
+// placeholder when Conn is set.
+func (o Options) Target() string {
+	if o.Conn != nil {
+		return "provided connection"
+	}
+	if o.Transport != "" {
+		return o.Transport
+	}
+	return "tcp://" + o.Address()
+}
+
+// ParseOptions builds Options from the defaults, then the environment, then
+// args (without the program name). Besides flags, args may carry the
+// positional "host port token" triple passed by the contest system.
+func ParseOptions(args []string) (Options, error) {
+	o := DefaultOptions()
+
+	if err := o.loadEnv(os.LookupEnv); err != nil {
+		return o, err
+	}
+
+	fs := flag.NewFlagSet("strategy", flag.ContinueOnError)
+	o.RegisterFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+
+	switch fs.NArg() {
+	case 0:
+	case 3:
+		o.Host, o.Port, o.Token = fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	default:
+		return o, fmt.Errorf("expected host, port and token, got %d positional arguments", fs.NArg())
+	}
+
+	return o, nil
+}
+
+// RegisterFlags defines a flag for every option, using the current values
+// of o as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Host, "host", o.Host, "server host")
+	fs.StringVar(&o.Port, "port", o.Port, "server port")
+	fs.StringVar(&o.Token, "token", o.Token, "authentication token")
+	fs.StringVar(&o.Transport, "transport", o.Transport, "server `url`: tcp://host:port, unix:///path or stdio:, overrides -host and -port")
+	fs.DurationVar(&o.ConnectTimeout, "connect-timeout", o.ConnectTimeout, "timeout of a single connection attempt")
+	fs.IntVar(&o.Retries, "retries", o.Retries, "number of reconnection attempts")
+	fs.DurationVar(&o.RetryDelay, "retry-delay", o.RetryDelay, "delay between connection attempts")
+	fs.Var(&o.LogLevel, "log-level", "log level: quiet, error, info or debug")
+	fs.StringVar(&o.RecordPath, "record", o.RecordPath, "write a session recording to `file`")
+	fs.DurationVar(&o.TickBudget, "tick-budget", o.TickBudget, "maximum time per move, 0 for no limit")
+	fs.Var(&o.LatePolicy, "late-policy", "what to do with a late move: discard or apply")
+	fs.BoolVar(&o.Pooled, "pooled", o.Pooled, "reuse vehicle updates between ticks; they are only valid during Move")
+	fs.StringVar(&o.Strategy, "strategy", o.Strategy, "play the strategy registered under `name`")
+	fs.BoolVar(&o.ListStrategies, "strategies", o.ListStrategies, "list the registered strategies and exit")
+	fs.StringVar(&o.Plugin, "plugin", o.Plugin, "play the strategy of the plugin `file` built with -buildmode=plugin")
+	fs.StringVar(&o.MetricsPath, "metrics", o.MetricsPath, "write the time spent in each phase of every tick to the CSV `file`")
+	fs.Var(&o.Trace, "trace", "log every field exchanged during the `ticks` from:to, or all")
+	fs.IntVar(&o.ProtocolVersion, "protocol-version", o.ProtocolVersion, "protocol version to announce to the server")
+	fs.IntVar(&o.MaxPanics, "max-panics", o.MaxPanics, "disable the strategy after this many consecutive panics, 0 for never")
+}
+
+func (o *Options) loadEnv(lookup func(string) (string, bool)) (err error) {
+	if v, ok := lookup(EnvHost); ok {
+		o.Host = v
+	}
+	if v, ok := lookup(EnvPort); ok {
+		o.Port = v
+	}
+	if v, ok := lookup(EnvToken); ok {
+		o.Token = v
+	}
+	if v, ok := lookup(EnvTransport); ok {
+		o.Transport = v
+	}
+	if v, ok := lookup(EnvConnectTimeout); ok {
+		if o.ConnectTimeout, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvConnectTimeout, err)
+		}
+	}
+	if v, ok := lookup(EnvRetries); ok {
+		if o.Retries, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvRetries, err)
+		}
+	}
+	if v, ok := lookup(EnvRetryDelay); ok {
+		if o.RetryDelay, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvRetryDelay, err)
+		}
+	}
+	if v, ok := lookup(EnvRecord); ok {
+		o.RecordPath = v
+	}
+	if v, ok := lookup(EnvTickBudget); ok {
+		if o.TickBudget, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvTickBudget, err)
+		}
+	}
+	if v, ok := lookup(EnvLatePolicy); ok {
+		if err = o.LatePolicy.Set(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvLatePolicy, err)
+		}
+	}
+	if v, ok := lookup(EnvPooled); ok {
+		if o.Pooled, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvPooled, err)
+		}
+	}
+	if v, ok := lookup(EnvStrategy); ok {
+		o.Strategy = v
+	}
+	if v, ok := lookup(EnvPlugin); ok {
+		o.Plugin = v
+	}
+	if v, ok := lookup(EnvMetrics); ok {
+		o.MetricsPath = v
+	}
+	if v, ok := lookup(EnvTrace); ok {
+		if err = o.Trace.Set(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvTrace, err)
+		}
+	}
+	if v, ok := lookup(EnvProtocol); ok {
+		if o.ProtocolVersion, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvProtocol, err)
+		}
+	}
+	if v, ok := lookup(EnvMaxPanics); ok {
+		if o.MaxPanics, err = strconv.Atoi(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvMaxPanics, err)
+		}
+	}
+	if v, ok := lookup(EnvLogLevel); ok {
+		if err = o.LogLevel.Set(v); err != nil {
+			return fmt.Errorf("%s: %w", EnvLogLevel, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package client
+
+import (
+	"fmt"
+	. "model"
+	"plugin"
+)
+
+// LoadPlugin opens a strategy plugin built with -buildmode=plugin against
+// the same model package and toolchain as the client, and returns the
+// factory it exports as PluginSymbol:
+//
+//	func NewStrategy() model.Strategy
+func LoadPlugin(path string) (Factory, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f := sym.(type) {
+	case func() Strategy:
+		return f, nil
+	case *func() Strategy:
+		return *f, nil
+	case *Factory:
+		return *f, nil
+	default:
+		return nil, fmt.Errorf("%s: %s is a %T, not a func() model.Strategy", path, PluginSymbol, sym)
+	}
+}
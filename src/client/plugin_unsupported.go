@@ -0,0 +1,10 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package client
+
+import "errors"
+
+// LoadPlugin always fails: Go plugins need cgo on Linux, macOS or FreeBSD.
+func LoadPlugin(path string) (Factory, error) {
+	return nil, errors.New("strategy plugins are not supported on this platform")
+}
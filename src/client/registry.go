@@ -0,0 +1,53 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a strategy available under name to the -strategy option,
+// typically from an init function. It panics if name is taken.
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if f == nil {
+		panic("client: Register of nil factory for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("client: Register called twice for " + name)
+	}
+	registry[name] = f
+}
+
+// Registered returns the names of the registered strategies, sorted.
+func Registered() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Lookup returns the factory registered under name.
+func Lookup(name string) (Factory, error) {
+	registryMu.Lock()
+	f, ok := registry[name]
+	registryMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, registered: %s", name, strings.Join(Registered(), ", "))
+	}
+	return f, nil
+}
@@ -1,583 +1,494 @@
 package client
 
 import (
-	. "model"
+	"codec"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	. "model"
 	"net"
-	"bufio"
-	"encoding/binary"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-var ByteOrder = binary.LittleEndian
+var ByteOrder = codec.ByteOrder
 
-type MessageType byte
+type MessageType = codec.MessageType
 
 const (
-	Message_GameOver MessageType = iota + 1
-	Message_AuthenticationToken
-	Message_TeamSize
-	Message_ProtocolVersion
-	Message_GameContext
-	Message_PlayerContext
-	Message_Move
+	Message_GameOver            = codec.Message_GameOver
+	Message_AuthenticationToken = codec.Message_AuthenticationToken
+	Message_TeamSize            = codec.Message_TeamSize
+	Message_ProtocolVersion     = codec.Message_ProtocolVersion
+	Message_GameContext         = codec.Message_GameContext
+	Message_PlayerContext       = codec.Message_PlayerContext
+	Message_Move                = codec.Message_Move
 )
 
-const Version int = 3
+const Version = codec.Version
 
 var (
-	ErrGameOver  = errors.New("game over")
-	ErrWrongType = errors.New("wrong message type")
+	ErrGameOver  = codec.ErrGameOver
+	ErrWrongType = codec.ErrWrongType
 )
 
-type RemoteProcessClient struct {
-	conn   net.Conn
-	reader *bufio.Reader
-	writer *bufio.Writer
-
-	players    map[int64]*Player
-	facilities map[int64]*Facility
-}
-
-func Start(s Strategy) {
-	var host, port, token string
-
-	if len(os.Args) == 4 {
-		host, port, token = os.Args[1], os.Args[2], os.Args[3]
-	} else {
-		host, port, token = "127.0.0.1", "31001", "0000000000000000"
-	}
-
-	cli := &RemoteProcessClient{
-		players:    make(map[int64]*Player),
-		facilities: make(map[int64]*Facility),
-	}
-
-	if err := cli.Dial(host, port); err == nil {
-		defer cli.Close()
+type ProtocolError = codec.ProtocolError
 
-		cli.writeToken(token)
-		cli.writeProtoVersion(Version)
-		cli.ReadTeamSize()
-
-		g := cli.readGame()
-
-		pc := &PlayerContext{Player: new(Player), World: new(World)}
-
-		for cli.readContext(pc) != ErrGameOver {
-			m := &Move{
-				Type:       Vehicle_None,
-				Action:     Action_None,
-				Factor:     1,
-				FacilityId: -1,
-				VehicleId:  -1,
-			}
+var ErrVersionMismatch = codec.ErrVersionMismatch
 
-			s.Move(pc.Player, pc.World, g, m)
-
-			cli.writeMove(m)
+type RemoteProcessClient struct {
+	conn io.ReadWriteCloser
+	dec  *codec.Decoder
+	enc  *codec.Encoder
+
+	level  LogLevel
+	limits codec.Limits
+	pooled bool
+	rec    *Recorder
+	trace  *tracer
+	meter  *meter
+	hist   *history
+}
+
+// Start runs the game loop with options taken from the command line and
+// the environment and terminates the process if it fails. The strategy is
+// wrapped in mw, the first middleware outermost.
+func Start(s Strategy, mw ...Middleware) {
+	StartWithOptions(s, commandLine(mw))
+}
+
+// StartTeam is like Start but plays every player of the team with its own
+// strategy instance made by f, which also plays games with one player per
+// team.
+func StartTeam(f Factory, mw ...Middleware) {
+	StartTeamWithOptions(f, commandLine(mw))
+}
+
+// commandLine returns the options taken from the command line and the
+// environment, with mw appended to their middlewares. It terminates the
+// process if they are invalid.
+func commandLine(mw []Middleware) Options {
+	opts, err := ParseOptions(os.Args[1:])
+	if err != nil {
+		log.Println(err)
+		os.Exit(ExitUsage)
+	}
+	opts.Middleware = append(opts.Middleware, mw...)
+	return opts
+}
+
+// StartWithOptions runs the game loop and terminates the process with a
+// non-zero exit code if it fails: ExitDisconnected if the server went away
+// before the game was over, ExitProtocol if it sent something the client
+// could not make sense of, ExitInterrupted if SIGINT or SIGTERM stopped it
+// and ExitFailure otherwise. A strategy selected in opts, by name or as a
+// plugin, replaces s.
+func StartWithOptions(s Strategy, opts Options) {
+	f, err := selected(opts)
+	exit(err, opts)
+	if f != nil {
+		s = f()
+	}
+	exit(Run(interruptible(), s, opts), opts)
+}
+
+// StartTeamWithOptions is like StartWithOptions but plays every player of
+// the team with its own strategy instance.
+func StartTeamWithOptions(f Factory, opts Options) {
+	sel, err := selected(opts)
+	exit(err, opts)
+	if sel != nil {
+		f = sel
+	}
+	exit(RunTeam(interruptible(), f, opts), opts)
+}
+
+// interruptible returns a context cancelled by SIGINT or SIGTERM. The first
+// signal restores the default handling, so a second one kills the process.
+func interruptible() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx
+}
+
+// selected returns the factory of the strategy chosen in opts, or nil. With
+// ListStrategies set it prints the registered names and exits instead.
+func selected(opts Options) (Factory, error) {
+	switch {
+	case opts.ListStrategies:
+		for _, name := range Registered() {
+			fmt.Println(name)
 		}
-
-		cli.Close()
-
-		return
-	} else {
-		panic(err)
+		os.Exit(0)
+	case opts.Strategy != "" && opts.Plugin != "":
+		return nil, errors.New("a strategy cannot be selected both by name and as a plugin")
+	case opts.Strategy != "":
+		return Lookup(opts.Strategy)
+	case opts.Plugin != "":
+		return LoadPlugin(opts.Plugin)
 	}
+	return nil, nil
 }
 
-func (c *RemoteProcessClient) readGame() *Game {
-	c.ensureMessageType(Message_GameContext)
-
-	if c.readBool() {
-		return &Game{
-			RandomSeed:                                            c.readInt64(),
-			TickCount:                                             c.readInt(),
-			WorldWidth:                                            c.readFloat64(),
-			WorldHeight:                                           c.readFloat64(),
-			FogOfWarEnabled:                                       c.readBool(),
-			VictoryScore:                                          c.readInt(),
-			FacilityCaptureScore:                                  c.readInt(),
-			VehicleEliminationScore:                               c.readInt(),
-			ActionDetectionInterval:                               c.readInt(),
-			BaseActionCount:                                       c.readInt(),
-			AdditionalActionCountPerControlCenter:                 c.readInt(),
-			MaxUnitGroup:                                          c.readInt(),
-			TerrainWeatherMapColumnCount:                          c.readInt(),
-			TerrainWeatherMapRowCount:                             c.readInt(),
-			PlainTerrainVisionFactor:                              c.readFloat64(),
-			PlainTerrainStealthFactor:                             c.readFloat64(),
-			PlainTerrainSpeedFactor:                               c.readFloat64(),
-			SwampTerrainVisionFactor:                              c.readFloat64(),
-			SwampTerrainStealthFactor:                             c.readFloat64(),
-			SwampTerrainSpeedFactor:                               c.readFloat64(),
-			ForestTerrainVisionFactor:                             c.readFloat64(),
-			ForestTerrainStealthFactor:                            c.readFloat64(),
-			ForestTerrainSpeedFactor:                              c.readFloat64(),
-			ClearWeatherVisionFactor:                              c.readFloat64(),
-			ClearWeatherStealthFactor:                             c.readFloat64(),
-			ClearWeatherSpeedFactor:                               c.readFloat64(),
-			CloudWeatherVisionFactor:                              c.readFloat64(),
-			CloudWeatherStealthFactor:                             c.readFloat64(),
-			CloudWeatherSpeedFactor:                               c.readFloat64(),
-			RainWeatherVisionFactor:                               c.readFloat64(),
-			RainWeatherStealthFactor:                              c.readFloat64(),
-			RainWeatherSpeedFactor:                                c.readFloat64(),
-			VehicleRadius:                                         c.readFloat64(),
-			TankDurability:                                        c.readInt(),
-			TankSpeed:                                             c.readFloat64(),
-			TankVisionRange:                                       c.readFloat64(),
-			TankGroundAttackRange:                                 c.readFloat64(),
-			TankAerialAttackRange:                                 c.readFloat64(),
-			TankGroundDamage:                                      c.readInt(),
-			TankAerialDamage:                                      c.readInt(),
-			TankGroundDefence:                                     c.readInt(),
-			TankAerialDefence:                                     c.readInt(),
-			TankAttackCooldownTicks:                               c.readInt(),
-			TankProductionCost:                                    c.readInt(),
-			IFVDurability:                                         c.readInt(),
-			IFVSpeed:                                              c.readFloat64(),
-			IFVVisionRange:                                        c.readFloat64(),
-			IFVGroundAttackRange:                                  c.readFloat64(),
-			IFVAerialAttackRange:                                  c.readFloat64(),
-			IFVGroundDamage:                                       c.readInt(),
-			IFVAerialDamage:                                       c.readInt(),
-			IFVGroundDefence:                                      c.readInt(),
-			IFVAerialDefence:                                      c.readInt(),
-			IFVAttackCooldownTicks:                                c.readInt(),
-			IFVProductionCost:                                     c.readInt(),
-			ARRVDurability:                                        c.readInt(),
-			ARRVSpeed:                                             c.readFloat64(),
-			ARRVVisionRange:                                       c.readFloat64(),
-			ARRVGroundDefence:                                     c.readInt(),
-			ARRVAerialDefence:                                     c.readInt(),
-			ARRVProductionCost:                                    c.readInt(),
-			ARRVRepairRange:                                       c.readFloat64(),
-			ARRVRepairSpeed:                                       c.readFloat64(),
-			HelicopterDurability:                                  c.readInt(),
-			HelicopterSpeed:                                       c.readFloat64(),
-			HelicopterVisionRange:                                 c.readFloat64(),
-			HelicopterGroundAttackRange:                           c.readFloat64(),
-			HelicopterAerialAttackRange:                           c.readFloat64(),
-			HelicopterGroundDamage:                                c.readInt(),
-			HelicopterAerialDamage:                                c.readInt(),
-			HelicopterGroundDefence:                               c.readInt(),
-			HelicopterAerialDefence:                               c.readInt(),
-			HelicopterAttackCooldownTicks:                         c.readInt(),
-			HelicopterProductionCost:                              c.readInt(),
-			FighterDurability:                                     c.readInt(),
-			FighterSpeed:                                          c.readFloat64(),
-			FighterVisionRange:                                    c.readFloat64(),
-			FighterGroundAttackRange:                              c.readFloat64(),
-			FighterAerialAttackRange:                              c.readFloat64(),
-			FighterGroundDamage:                                   c.readInt(),
-			FighterAerialDamage:                                   c.readInt(),
-			FighterGroundDefence:                                  c.readInt(),
-			FighterAerialDefence:                                  c.readInt(),
-			FighterAttackCooldownTicks:                            c.readInt(),
-			FighterProductionCost:                                 c.readInt(),
-			MaxFacilityCapturePoints:                              c.readFloat64(),
-			FacilityCapturePointsPerVehiclePerTick:                c.readFloat64(),
-			FacilityWidth:                                         c.readFloat64(),
-			FacilityHeight:                                        c.readFloat64(),
-			BaseTacticalNuclearStrikeCooldown:                     c.readInt(),
-			TacticalNuclearStrikeCooldownDecreasePerControlCenter: c.readInt(),
-			TacticalNuclearStrikeMaxDamage:                        c.readFloat64(),
-			TacticalNuclearStrikeRadius:                           c.readFloat64(),
-			TacticalNuclearStrikeDelay:                            c.readInt(),
+func exit(err error, opts Options) {
+	if err != nil {
+		if opts.LogLevel >= LogError {
+			log.Println(err)
 		}
+		os.Exit(exitCode(err))
 	}
-
-	return nil
 }
 
-func (c *RemoteProcessClient) readContext(pc *PlayerContext) error {
-	switch c.readOpcode() {
-	case Message_GameOver:
-		return ErrGameOver
-	case Message_PlayerContext:
-		if c.readBool() {
-			if me := c.readPlayer(); me != nil {
-				*pc.Player = *me
-			}
-			c.readWorld(pc.World)
-		}
-		return nil
-	default:
-		return ErrWrongType
-	}
-}
+// Factory creates a strategy instance for one player of a team.
+type Factory func() Strategy
 
-func (c *RemoteProcessClient) readPlayer() *Player {
-	switch c.readByte() {
-	case 0:
-		return nil
-	case 127:
-		return c.players[c.readInt64()]
-	default:
-		p := new(Player)
-		p.Id = c.readInt64()
-		p.Me = c.readBool()
-		p.StrategyCrashed = c.readBool()
-		p.Score = c.readInt()
-		p.RemainingActionCooldownTicks = c.readInt()
-		p.RemainingNuclearStrikeCooldownTicks = c.readInt()
-		p.NextNuclearStrikeVehicleId = c.readInt64()
-		p.NextNuclearStrikeTickIndex = c.readInt()
-		p.NextNuclearStrikeX = c.readFloat64()
-		p.NextNuclearStrikeY = c.readFloat64()
-
-		c.players[p.Id] = p
-
-		return p
-	}
+// PluginSymbol is the name of the factory a strategy plugin exports.
+const PluginSymbol = "NewStrategy"
+
+// Run connects to the server described by opts, plays the game with s and
+// returns the first error that interrupted it. A normal game over yields nil;
+// a lost connection and unexpected data from the server yield errors wrapping
+// ErrDisconnected and ErrProtocol, the latter after logging the bytes around
+// the failure. Cancelling ctx closes the connection and makes Run return an
+// error wrapping ctx.Err(), except over stdio: where Run only returns once
+// the server sends data or closes the stream, see DialURL. The strategy's
+// End is called in every case. Games with more than one player per team
+// require RunTeam.
+func Run(ctx context.Context, s Strategy, opts Options) error {
+	return run(ctx, opts, func(teamSize int) ([]Strategy, error) {
+		if teamSize != 1 {
+			return nil, fmt.Errorf("team size is %d, use RunTeam to play one strategy per player", teamSize)
+		}
+		return []Strategy{s}, nil
+	})
+}
+
+// RunTeam is like Run but creates one strategy per player of the team. At
+// every tick the server sends a context for each player in turn, and the
+// moves are sent back in the same order.
+func RunTeam(ctx context.Context, f Factory, opts Options) error {
+	return run(ctx, opts, func(teamSize int) ([]Strategy, error) {
+		team := make([]Strategy, teamSize)
+		for i := range team {
+			team[i] = f()
+		}
+		return team, nil
+	})
 }
 
-func (c *RemoteProcessClient) readWorld(w *World) {
-	if c.readBool() {
-		w.TickIndex = c.readInt()
-		w.TickCount = c.readInt()
-		w.Width = c.readFloat64()
-		w.Height = c.readFloat64()
-		w.Players = c.readPlayers()
-		w.NewVehicles = c.readVehicles()
-		w.VehicleUpdates = c.readVehiclesUpdate()
-
-		if w.TickIndex == 0 {
-			w.TerrainByCellXY = c.readTerrains()
-			w.WeatherByCellXY = c.readWeather()
+func run(ctx context.Context, opts Options, team func(teamSize int) ([]Strategy, error)) (ret error) {
+	cli := newClient(opts)
+	defer func() {
+		if ret != nil && ctx.Err() != nil {
+			ret = fmt.Errorf("game interrupted: %w", ctx.Err())
+			return
 		}
+		ret = classify(ret)
+		var pe *ProtocolError
+		if errors.Is(ret, ErrProtocol) && errors.As(ret, &pe) && pe.Op == "read" {
+			cli.logf(LogError, "received around offset %d:\n%s", pe.Offset, cli.dump(pe.Offset))
+		}
+	}()
 
-		w.Facilities = c.readFacilities()
+	if err := cli.connect(ctx, opts); err != nil {
+		return err
 	}
-}
+	defer cli.Close()
+	defer context.AfterFunc(ctx, func() { cli.Close() })()
 
-func (c *RemoteProcessClient) writeMove(m *Move) {
-	c.writeOpcode(Message_Move)
+	cli.logf(LogInfo, "connected to %s", opts.Target())
 
-	if m == nil {
-		c.writeBool(false)
-	} else {
-		c.writeBool(true)
-
-		c.writeByte(byte(m.Action))
-		c.writeInt(m.Group)
-		c.writeFloat64(m.Left)
-		c.writeFloat64(m.Top)
-		c.writeFloat64(m.Right)
-		c.writeFloat64(m.Bottom)
-		c.writeFloat64(m.X)
-		c.writeFloat64(m.Y)
-		c.writeFloat64(m.Angle)
-		c.writeFloat64(m.Factor)
-		c.writeFloat64(m.MaxSpeed)
-		c.writeFloat64(m.MaxAngularSpeed)
-		c.writeByte(byte(m.Type))
-		c.writeInt64(m.FacilityId)
-		c.writeInt64(m.VehicleId)
-	}
-
-	c.flush()
-}
+	if opts.Trace.Enabled {
+		cli.setTracer(newTracer(opts.Trace))
+	}
 
-func (c *RemoteProcessClient) readWeather() (weather [][]Weather) {
-	for i := c.readInt(); i > 0; i-- {
-		var slice []Weather
-		for j := c.readInt(); j > 0; j-- {
-			slice = append(slice, Weather(c.readByte()))
+	if m := cli.meter; m != nil {
+		if opts.MetricsPath != "" {
+			if err := m.createCSV(opts.MetricsPath); err != nil {
+				return err
+			}
 		}
-		weather = append(weather, slice)
+		defer func() {
+			if m.m.Move.Len() > 0 {
+				cli.logf(LogInfo, "tick times: %v", m.m)
+			}
+			if err := m.Close(); err != nil && ret == nil {
+				ret = err
+			}
+		}()
 	}
 
-	return
-}
-
-func (c *RemoteProcessClient) readTerrains() (terrain [][]Terrain) {
-	for i := c.readInt(); i > 0; i-- {
-		var slice []Terrain
-		for j := c.readInt(); j > 0; j-- {
-			slice = append(slice, Terrain(c.readByte()))
+	if opts.RecordPath != "" {
+		rec, err := CreateRecorder(opts.RecordPath)
+		if err != nil {
+			return err
 		}
-		terrain = append(terrain, slice)
+		cli.setRecorder(rec)
+		defer func() {
+			if err := rec.Close(); err != nil && ret == nil {
+				ret = err
+			}
+		}()
 	}
-	return
-}
-
-func (c *RemoteProcessClient) readFacility() *Facility {
-	switch c.readByte() {
-	case 0:
-		return nil
-	case 127:
-		return c.facilities[c.readInt64()]
-	default:
-		f := new(Facility)
-		f.Id = c.readInt64()
-		f.FacilityType = FacilityType(c.readByte())
-		f.OwnerPlayerId = c.readInt64()
-		f.Left = c.readFloat64()
-		f.Top = c.readFloat64()
-		f.CapturePoints = c.readFloat64()
-		f.VehicleType = VehicleType(c.readByte())
-		f.ProductionProgress = c.readInt()
 
-		c.facilities[f.Id] = f
-
-		return f
+	if err := cli.writeToken(opts.Token); err != nil {
+		return err
 	}
-}
-
-func (c *RemoteProcessClient) readVehicleUpdate() *VehicleUpdate {
-	if c.readBool() {
-		v := new(VehicleUpdate)
-		v.Id = c.readInt64()
-		v.X = c.readFloat64()
-		v.Y = c.readFloat64()
-		v.Durability = c.readInt()
-		v.RemainingAttackCooldownTicks = c.readInt()
-		v.Selected = c.readBool()
-		v.Groups = c.readIntArray()
-
-		return v
+	if err := cli.writeProtoVersion(opts.ProtocolVersion); err != nil {
+		return err
+	}
+	teamSize, err := cli.ReadTeamSize()
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	strategies, err := team(teamSize)
+	if err != nil {
+		return err
+	}
+	g, err := cli.readGame()
+	if err != nil {
+		return err
+	}
 
-func (c *RemoteProcessClient) readNewVehicle() *Vehicle {
-	if c.readBool() {
-		v := new(Vehicle)
-		v.Id = c.readInt64()
-		v.X = c.readFloat64()
-		v.Y = c.readFloat64()
-		v.Radius = c.readFloat64()
-		v.PlayerId = c.readInt64()
-		v.Durability = c.readInt()
-		v.MaxDurability = c.readInt()
-		v.MaxSpeed = c.readFloat64()
-		v.VisionRange = c.readFloat64()
-		v.SquaredVisionRange = c.readFloat64()
-		v.GroundAttackRange = c.readFloat64()
-		v.SquaredGroundAttackRange = c.readFloat64()
-		v.AerialAttackRange = c.readFloat64()
-		v.SquaredAerialAttackRange = c.readFloat64()
-		v.GroundDamage = c.readInt()
-		v.AerialDamage = c.readInt()
-		v.GroundDefence = c.readInt()
-		v.AerialDefence = c.readInt()
-		v.AttackCooldownTicks = c.readInt()
-		v.RemainingAttackCooldownTicks = c.readInt()
-		v.Type = VehicleType(c.readByte())
-		v.Aerial = c.readBool()
-		v.Selected = c.readBool()
-		v.Groups = c.readIntArray()
-
-		return v
-	}
-
-	return nil
-}
+	drivers := make([]*driver, teamSize)
+	contexts := make([]*PlayerContext, teamSize)
+	for i, s := range strategies {
+		drivers[i] = newDriver(cli, s, opts)
+		drivers[i].start(g, teamSize)
+		contexts[i] = &PlayerContext{Player: new(Player), World: new(World)}
+	}
 
-func (c *RemoteProcessClient) readVehiclesUpdate() (updates []*VehicleUpdate) {
-	for l := c.readInt(); l > 0; l-- {
-		if v := c.readVehicleUpdate(); v != nil {
-			updates = append(updates, v)
+	// However the game ends the strategies are told, with the last world
+	// received, which is incomplete if reading it failed.
+	defer func() {
+		for i, d := range drivers {
+			d.end(contexts[i].World)
+			d.report()
 		}
-	}
-	return
-}
+	}()
 
-func (c *RemoteProcessClient) readFacilities() (facilities []*Facility) {
-	if l := c.readInt(); l > 0 {
-		for ; l > 0; l-- {
-			if f := c.readFacility(); f != nil {
-				facilities = append(facilities, f)
+	for {
+		for i, d := range drivers {
+			if d.busy() {
+				contexts[i] = detach(contexts[i])
 			}
-		}
-	} else {
-		for _, f := range c.facilities {
-			facilities = append(facilities, f)
-		}
-	}
 
-	return
-}
+			cli.meter.startRead()
+			err := cli.readContext(contexts[i])
+			cli.meter.endRead()
 
-func (c *RemoteProcessClient) readVehicles() (vehicles []*Vehicle) {
-	for l := c.readInt(); l > 0; l-- {
-		if v := c.readNewVehicle(); v != nil {
-			vehicles = append(vehicles, v)
+			if err == ErrGameOver {
+				cli.logf(LogInfo, "game over")
+				return nil
+			} else if err != nil {
+				return err
+			}
 		}
-	}
-	return
-}
 
-func (c *RemoteProcessClient) readPlayers() (players []*Player) {
-	if l := c.readInt(); l > 0 {
-		for ; l > 0; l-- {
-			if p := c.readPlayer(); p != nil {
-				players = append(players, p)
+		for i, d := range drivers {
+			cli.meter.startMove()
+			m := d.move(ctx, contexts[i], g)
+			cli.meter.startWrite()
+			err := cli.writeMove(m)
+			cli.meter.endWrite()
+			if err != nil {
+				return err
 			}
 		}
-	} else {
-		for _, p := range c.players {
-			players = append(players, p)
+
+		if err := cli.meter.endTick(contexts[0].World.TickIndex); err != nil {
+			return err
 		}
 	}
-
-	return
 }
 
-func (c *RemoteProcessClient) Dial(host, port string) (err error) {
-	if c.conn, err = net.Dial("tcp", host+":"+port); err == nil {
-		c.reader = bufio.NewReader(c.conn)
-		c.writer = bufio.NewWriter(c.conn)
+func newClient(opts Options) *RemoteProcessClient {
+	c := &RemoteProcessClient{level: opts.LogLevel, limits: opts.Limits, pooled: opts.Pooled}
+	if opts.Metrics != nil || opts.MetricsPath != "" {
+		c.meter = newMeter(opts.Metrics)
 	}
-
-	return
+	return c
 }
 
-func (c *RemoteProcessClient) writeToken(token string) {
-	c.writeOpcode(Message_AuthenticationToken)
-	c.writeString(token)
-	c.flush()
-}
-
-func (c *RemoteProcessClient) writeProtoVersion(ver int) {
-	c.writeOpcode(Message_ProtocolVersion)
-	c.writeInt(ver)
-	c.flush()
+// newMove returns the move passed to the strategy at the start of a tick.
+func newMove() *Move {
+	return &Move{
+		Type:       Vehicle_None,
+		Action:     Action_None,
+		Factor:     1,
+		FacilityId: -1,
+		VehicleId:  -1,
+	}
 }
 
-func (c *RemoteProcessClient) ReadTeamSize() int {
-	c.ensureMessageType(Message_TeamSize)
-	return c.readInt()
+func (c *RemoteProcessClient) readGame() (*Game, error) {
+	c.beginRead()
+	g, err := c.dec.ReadGameContextMessage()
+	c.endRead(-1, err)
+	return g, err
 }
 
-func (c *RemoteProcessClient) Close() error {
-	return c.conn.Close()
+func (c *RemoteProcessClient) readContext(pc *PlayerContext) error {
+	c.beginRead()
+	switch err := c.dec.ReadContextMessage(pc); err {
+	case nil:
+		c.endRead(pc.World.TickIndex, nil)
+		return nil
+	case ErrGameOver:
+		c.endRead(-1, nil)
+		return err
+	default:
+		c.endRead(-1, err)
+		return err
+	}
 }
 
-func (c *RemoteProcessClient) readOpcode() MessageType {
-	return MessageType(c.readByte())
+func (c *RemoteProcessClient) writeMove(m *Move) error {
+	c.beginWrite()
+	c.enc.WriteMoveMessage(m)
+	return c.flush()
 }
 
-func (c *RemoteProcessClient) readIntArray() []int {
-	var arr []int
-	if ln := c.readInt(); ln > 0 {
-		for ; ln > 0; ln-- {
-			arr = append(arr, c.readInt())
-		}
+func (c *RemoteProcessClient) Dial(host, port string) (err error) {
+	if c.conn, err = net.Dial("tcp", host+":"+port); err == nil {
+		c.attach(c.conn)
 	}
-	return arr
-}
 
-func (c *RemoteProcessClient) readInt() int {
-	var v int32
-	if err := binary.Read(c.reader, ByteOrder, &v); err != nil {
-		panic(err)
-	}
-	return int(v)
+	return
 }
 
-func (c *RemoteProcessClient) readInt64() int64 {
-	var v int64
-	if err := binary.Read(c.reader, ByteOrder, &v); err != nil {
-		panic(err)
+// connect dials the server, retrying according to opts, unless opts
+// already carries a connection.
+func (c *RemoteProcessClient) connect(ctx context.Context, opts Options) error {
+	if opts.Conn != nil {
+		c.attach(opts.Conn)
+		return nil
 	}
-	return v
-}
 
-func (c *RemoteProcessClient) readFloat64() float64 {
-	var v float64
-	if err := binary.Read(c.reader, ByteOrder, &v); err != nil {
-		panic(err)
+	for attempt := 0; ; attempt++ {
+		conn, err := DialURL(ctx, opts.Target(), opts.ConnectTimeout)
+		if err == nil {
+			c.attach(conn)
+			return nil
+		}
+		if attempt >= opts.Retries {
+			return err
+		}
+
+		c.logf(LogInfo, "%v, retrying in %v", err, opts.RetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.RetryDelay):
+		}
 	}
-	return v
 }
 
-func (c *RemoteProcessClient) writeBool(b bool) {
-	if b {
-		c.writeByte(1)
+func (c *RemoteProcessClient) attach(conn io.ReadWriteCloser) {
+	c.conn = conn
+	c.hist = &history{r: conn}
+	if c.meter != nil {
+		c.meter.r = c.hist
+		c.dec = codec.NewDecoder(c.meter)
 	} else {
-		c.writeByte(0)
+		c.dec = codec.NewDecoder(c.hist)
 	}
+	c.dec.SetLimits(c.limits)
+	c.dec.SetPooled(c.pooled)
+	c.enc = codec.NewEncoder(conn)
 }
 
-func (c *RemoteProcessClient) readBool() bool {
-	return c.readByte() != 0
+func (c *RemoteProcessClient) setRecorder(rec *Recorder) {
+	c.rec = rec
+	c.dec.SetTap(&rec.in)
+	c.enc.SetTap(&rec.out)
 }
 
-func (c *RemoteProcessClient) readByte() byte {
-	b, err := c.reader.ReadByte()
-	if err != nil {
-		panic(err)
-	}
-	return b
+func (c *RemoteProcessClient) setTracer(t *tracer) {
+	c.trace = t
+	t.dec, t.enc, t.hist = c.dec, c.enc, c.hist
 }
 
-func (c *RemoteProcessClient) readString() string {
-	return string(c.readBytes())
+func (c *RemoteProcessClient) writeToken(token string) error {
+	c.beginWrite()
+	c.enc.WriteTokenMessage(token)
+	return c.flush()
 }
 
-func (c *RemoteProcessClient) ensureMessageType(m MessageType) {
-	if b, err := c.reader.ReadByte(); err != nil || b != byte(m) {
-		panic(ErrWrongType)
+// writeProtoVersion announces ver, or Version if it is zero, and switches
+// the codec to its message layouts.
+func (c *RemoteProcessClient) writeProtoVersion(ver int) error {
+	if ver == 0 {
+		ver = Version
+	}
+	if err := c.dec.SetVersion(ver); err != nil {
+		return err
 	}
+	c.enc.SetVersion(ver)
+	c.beginWrite()
+	c.enc.WriteProtocolVersionMessage(ver)
+	return c.flush()
 }
 
-func (c *RemoteProcessClient) writeOpcode(m MessageType) {
-	c.writeByte(byte(m))
+func (c *RemoteProcessClient) ReadTeamSize() (int, error) {
+	c.beginRead()
+	size, err := c.dec.ReadTeamSizeMessage()
+	c.endRead(-1, err)
+	return size, err
 }
 
-func (c *RemoteProcessClient) writeInt(v int) {
-	if err := binary.Write(c.writer, ByteOrder, int32(v)); err != nil {
-		panic(err)
+func (c *RemoteProcessClient) Close() error {
+	if c.conn == nil {
+		return nil
 	}
+	return c.conn.Close()
 }
 
-func (c *RemoteProcessClient) writeFloat64(v float64) {
-	if err := binary.Write(c.writer, ByteOrder, v); err != nil {
-		panic(err)
+// Err returns the first error encountered while reading or writing.
+func (c *RemoteProcessClient) Err() error {
+	if c.dec == nil {
+		return nil
 	}
-}
-
-func (c *RemoteProcessClient) writeInt64(v int64) {
-	if err := binary.Write(c.writer, ByteOrder, v); err != nil {
-		panic(err)
+	if err := c.dec.Err(); err != nil {
+		return err
 	}
+	return c.enc.Err()
 }
 
-func (c *RemoteProcessClient) readBytes() []byte {
-	l := c.readInt()
-	r := make([]byte, l)
-	for i := range r {
-		r[i] = c.readByte()
+func (c *RemoteProcessClient) flush() error {
+	err := c.enc.Flush()
+	if c.rec != nil {
+		c.rec.endWrite()
 	}
-	return r
-}
-
-func (c *RemoteProcessClient) writeByte(v byte) {
-	if err := c.writer.WriteByte(v); err != nil {
-		panic(err)
+	if c.trace != nil {
+		c.trace.endWrite(err)
 	}
+	return err
 }
 
-func (c *RemoteProcessClient) writeBytes(v []byte) {
-	c.writeInt(len(v))
-	if _, err := c.writer.Write(v); err != nil {
-		panic(err)
+func (c *RemoteProcessClient) beginRead() {
+	if c.trace != nil {
+		c.trace.beginRead()
 	}
 }
 
-func (c *RemoteProcessClient) writeString(v string) {
-	c.writeInt(len(v))
-	if _, err := c.writer.WriteString(v); err != nil {
-		panic(err)
+func (c *RemoteProcessClient) beginWrite() {
+	if c.trace != nil {
+		c.trace.beginWrite()
 	}
 }
 
-func (c *RemoteProcessClient) flush() {
-	if err := c.writer.Flush(); err != nil {
-		panic(err)
+func (c *RemoteProcessClient) endRead(tick int, err error) {
+	if c.rec != nil {
+		c.rec.endRead(tick)
+	}
+	if c.trace != nil {
+		c.trace.endRead(tick, err)
 	}
 }
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"codec"
+	"fmt"
+	"io"
+	. "model"
+	"os"
+)
+
+// maxRecordSize bounds a single record, which holds at most one message.
+const maxRecordSize = 1 << 26
+
+// SessionReader iterates over the records of a session file.
+type SessionReader struct {
+	r *bufio.Reader
+}
+
+func NewSessionReader(r io.Reader) (*SessionReader, error) {
+	s := &SessionReader{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(SessionMagic))
+	if _, err := io.ReadFull(s.r, magic); err != nil || string(magic) != SessionMagic {
+		return nil, ErrNotSession
+	}
+
+	return s, nil
+}
+
+// Next returns the next record. It returns io.EOF after the last one.
+func (s *SessionReader) Next() (RecordKind, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(s.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("truncated record header: %w", err)
+		}
+		return 0, nil, err
+	}
+
+	n := ByteOrder.Uint32(hdr[1:])
+	if n > maxRecordSize {
+		return 0, nil, fmt.Errorf("%d-byte record: %w", n, codec.ErrTooLong)
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(s.r, payload); err != nil {
+		return 0, nil, fmt.Errorf("truncated %d-byte record: %w", len(payload), io.ErrUnexpectedEOF)
+	}
+
+	return RecordKind(hdr[0]), payload, nil
+}
+
+// ReplayTick compares the move sent during a recorded game with the move
+// the strategy produces for the same tick now. Member is the index of the
+// player in the team, always 0 outside team games. Original is nil if the
+// recording holds no move for the tick. Err holds a panic of the strategy
+// on the tick, Replayed then being the empty move a live game would send.
+type ReplayTick struct {
+	TickIndex int
+	Member    int
+	Original  *Move
+	Replayed  *Move
+	Err       error
+}
+
+func (t ReplayTick) Diverged() bool {
+	return t.Original == nil || t.Err != nil || *t.Original != *t.Replayed
+}
+
+// Replay feeds the game recorded at path into s tick by tick, decoding the
+// server messages with the same code as a live game. Games with more than
+// one player per team require ReplayTeam.
+func Replay(path string, s Strategy) ([]ReplayTick, error) {
+	return replay(path, func(teamSize int) ([]Strategy, error) {
+		if teamSize != 1 {
+			return nil, fmt.Errorf("team size is %d, use ReplayTeam to replay one strategy per player", teamSize)
+		}
+		return []Strategy{s}, nil
+	})
+}
+
+// ReplayTeam is like Replay but creates one strategy per player of the
+// team, as RunTeam does. The ticks are listed in the order the moves were
+// sent: for each tick, every member in turn.
+func ReplayTeam(path string, f Factory) ([]ReplayTick, error) {
+	return replay(path, func(teamSize int) ([]Strategy, error) {
+		team := make([]Strategy, teamSize)
+		for i := range team {
+			team[i] = f()
+		}
+		return team, nil
+	})
+}
+
+func replay(path string, team func(teamSize int) ([]Strategy, error)) ([]ReplayTick, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sr, err := NewSessionReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var (
+		src        = new(bytes.Reader)
+		in         = codec.NewDecoder(src)
+		out        = codec.NewDecoder(src)
+		g          *Game
+		teamSize   int
+		strategies []Strategy
+		contexts   []*PlayerContext
+		ticks      []ReplayTick
+		// pending holds the ticks of the members whose move has not been
+		// read yet, in the order the moves are sent; next is the member
+		// the next context is for.
+		pending []ReplayTick
+		next    int
+	)
+
+	for {
+		kind, payload, err := sr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ticks, err
+		}
+		if len(payload) == 0 {
+			continue
+		}
+
+		switch kind {
+		case Record_Read:
+			src.Reset(payload)
+			in.Reset(src)
+
+			switch MessageType(payload[0]) {
+			case Message_TeamSize:
+				if teamSize, err = in.ReadTeamSizeMessage(); err != nil {
+					break
+				}
+				if strategies, err = team(teamSize); err != nil {
+					break
+				}
+				contexts = make([]*PlayerContext, teamSize)
+				for i := range contexts {
+					contexts[i] = &PlayerContext{Player: new(Player), World: new(World)}
+				}
+			case Message_GameContext:
+				if g, err = in.ReadGameContextMessage(); err != nil {
+					break
+				}
+				for _, s := range strategies {
+					if err = startGame(s, g, teamSize); err != nil {
+						break
+					}
+				}
+			default:
+				if strategies == nil {
+					err = fmt.Errorf("%s before the team size", MessageType(payload[0]))
+					break
+				}
+				pc := contexts[next]
+				if err = in.ReadContextMessage(pc); err == ErrGameOver {
+					for i, s := range strategies {
+						if err = endGame(s, contexts[i].World); err != nil {
+							break
+						}
+					}
+					break
+				} else if err != nil {
+					break
+				}
+
+				// A new tick starts: moves still missing were never sent.
+				if next == 0 {
+					ticks = append(ticks, pending...)
+					pending = pending[:0]
+				}
+
+				m, merr := callMove(strategies[next], pc, g)
+				pending = append(pending, ReplayTick{TickIndex: pc.World.TickIndex, Member: next, Replayed: m, Err: merr})
+				next = (next + 1) % teamSize
+			}
+		case Record_Write:
+			src.Reset(payload)
+			out.Reset(src)
+
+			if MessageType(payload[0]) == Message_ProtocolVersion {
+				var ver int
+				if ver, err = out.ReadProtocolVersionMessage(); err == nil {
+					err = in.SetVersion(ver)
+				}
+				break
+			}
+			if MessageType(payload[0]) != Message_Move || len(pending) == 0 {
+				continue
+			}
+			if pending[0].Original, err = out.ReadMoveMessage(); err == nil {
+				ticks = append(ticks, pending[0])
+				pending = pending[1:]
+			}
+		}
+
+		if err != nil {
+			return ticks, err
+		}
+	}
+
+	return append(ticks, pending...), nil
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"codec"
+	"context"
+	"errors"
+	"mockserver"
+	. "model"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// listOrder encodes the order of the players and facilities it sees into
+// its move, one decimal digit per Id.
+type listOrder struct{}
+
+func (listOrder) Move(me *Player, world *World, game *Game, move *Move) {
+	for _, p := range world.Players {
+		move.X = move.X*10 + float64(p.Id)
+	}
+	for _, f := range world.Facilities {
+		move.Y = move.Y*10 + float64(f.Id)
+	}
+}
+
+// recordUnchangedLists records a game whose first tick lists the players
+// and facilities out of Id order and whose later ticks send both lists
+// empty, leaving the decoder to rebuild them from its caches.
+func recordUnchangedLists(t *testing.T) string {
+	t.Helper()
+
+	me := &Player{Id: 2, Me: true}
+	players := []*Player{{Id: 3}, me, {Id: 1}}
+	facilities := []*Facility{{Id: 7}, {Id: 4}, {Id: 9}, {Id: 5}}
+
+	scenario := &mockserver.Scenario{TeamSize: 1, Game: &Game{TickCount: 20}}
+	scenario.Ticks = append(scenario.Ticks, []*PlayerContext{{Player: me, World: &World{Players: players, Facilities: facilities}}})
+	for tick := 1; tick < 20; tick++ {
+		scenario.Ticks = append(scenario.Ticks, []*PlayerContext{{Player: me, World: &World{TickIndex: tick}}})
+	}
+
+	srv, err := mockserver.Listen("127.0.0.1:0", scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go srv.Serve()
+
+	opts := DefaultOptions()
+	opts.Host, opts.Port, _ = net.SplitHostPort(srv.Addr().String())
+	opts.LogLevel = LogQuiet
+	opts.RecordPath = filepath.Join(t.TempDir(), "game.cws")
+	if err := Run(context.Background(), listOrder{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	return opts.RecordPath
+}
+
+func TestReplayDeterministicOrder(t *testing.T) {
+	path := recordUnchangedLists(t)
+
+	var first []byte
+	for run := 0; run < 10; run++ {
+		ticks, err := Replay(path, listOrder{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ticks) != 20 {
+			t.Fatalf("run %d: %d ticks replayed, want 20", run, len(ticks))
+		}
+
+		var buf bytes.Buffer
+		e := codec.NewEncoder(&buf)
+		for _, tick := range ticks {
+			if tick.Diverged() {
+				t.Errorf("run %d, tick %d: replayed %+v, recorded %+v", run, tick.TickIndex, *tick.Replayed, tick.Original)
+			}
+			e.WriteMoveMessage(tick.Replayed)
+		}
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if run == 0 {
+			first = buf.Bytes()
+			if m := ticks[len(ticks)-1].Replayed; m.X != 321 || m.Y != 7495 {
+				t.Errorf("last tick: lists ordered as %v and %v, want 321 and 7495 as first sent", m.X, m.Y)
+			}
+		} else if !bytes.Equal(buf.Bytes(), first) {
+			t.Fatalf("run %d: replayed moves differ from the first run", run)
+		}
+	}
+}
+
+// panicOn panics on one tick and moves to the tick index on the others.
+type panicOn int
+
+func (p panicOn) Move(me *Player, world *World, game *Game, move *Move) {
+	if world.TickIndex == int(p) {
+		panic("tick " + strconv.Itoa(world.TickIndex))
+	}
+	move.X = float64(world.TickIndex)
+}
+
+func TestReplayPanic(t *testing.T) {
+	ticks, err := Replay(recordUnchangedLists(t), panicOn(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ticks) != 20 {
+		t.Fatalf("%d ticks replayed, want 20", len(ticks))
+	}
+	for _, tick := range ticks {
+		var pe *panicError
+		if panicked := errors.As(tick.Err, &pe); panicked != (tick.TickIndex == 5) {
+			t.Errorf("tick %d: error %v", tick.TickIndex, tick.Err)
+		}
+		if !tick.Diverged() {
+			t.Errorf("tick %d: replayed %+v as recorded", tick.TickIndex, *tick.Replayed)
+		}
+		if want := float64(tick.TickIndex); tick.TickIndex != 5 && tick.Replayed.X != want {
+			t.Errorf("tick %d: replayed X %v, want %v", tick.TickIndex, tick.Replayed.X, want)
+		}
+	}
+}
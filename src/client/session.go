@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// A session file starts with SessionMagic followed by records. Each record
+// is a RecordKind byte, an int32 payload length and the payload itself.
+// Record_Read and Record_Write payloads hold exactly one protocol message as
+// it was seen on the wire; Record_Tick holds the int32 index of the tick
+// whose messages follow.
+const SessionMagic = "CWSESS1\n"
+
+type RecordKind byte
+
+const (
+	Record_Read RecordKind = iota + 1
+	Record_Write
+	Record_Tick
+)
+
+var ErrNotSession = errors.New("not a session file")
+
+// Recorder writes the traffic of a RemoteProcessClient to a session file.
+type Recorder struct {
+	w      *bufio.Writer
+	closer io.Closer
+	err    error
+
+	// in and out accumulate the bytes of the message currently being read
+	// or written.
+	in, out bytes.Buffer
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{w: bufio.NewWriter(w)}
+	_, r.err = r.w.WriteString(SessionMagic)
+	return r
+}
+
+func CreateRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(f)
+	r.closer = f
+	return r, nil
+}
+
+func (r *Recorder) record(kind RecordKind, payload []byte) {
+	if r.err != nil {
+		return
+	}
+	var hdr [5]byte
+	hdr[0] = byte(kind)
+	ByteOrder.PutUint32(hdr[1:], uint32(len(payload)))
+	if _, r.err = r.w.Write(hdr[:]); r.err == nil {
+		_, r.err = r.w.Write(payload)
+	}
+}
+
+// Record stores a message seen by something other than the client the
+// recorder is attached to, such as a proxy. The caller frames the messages;
+// Record must not be mixed with recording through a RemoteProcessClient.
+func (r *Recorder) Record(kind RecordKind, payload []byte) error {
+	r.record(kind, payload)
+	return r.err
+}
+
+// Tick stores a marker for the tick whose messages follow.
+func (r *Recorder) Tick(tick int) error {
+	var b [4]byte
+	ByteOrder.PutUint32(b[:], uint32(tick))
+	r.record(Record_Tick, b[:])
+	return r.err
+}
+
+func (r *Recorder) Flush() error {
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	return r.err
+}
+
+// endRead stores the buffered inbound message, preceded by a tick marker
+// when tick is not negative.
+func (r *Recorder) endRead(tick int) {
+	if tick >= 0 {
+		r.Tick(tick)
+	}
+	if r.in.Len() > 0 {
+		r.record(Record_Read, r.in.Bytes())
+		r.in.Reset()
+	}
+}
+
+// endWrite stores the buffered outbound message.
+func (r *Recorder) endWrite() {
+	if r.out.Len() > 0 {
+		r.record(Record_Write, r.out.Bytes())
+		r.out.Reset()
+	}
+	r.Flush()
+}
+
+// Close stores any partially read message, flushes the file and returns
+// the first error encountered while recording.
+func (r *Recorder) Close() error {
+	r.endRead(-1)
+	r.endWrite()
+	if r.closer != nil {
+		if err := r.closer.Close(); r.err == nil {
+			r.err = err
+		}
+	}
+	return r.err
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	. "model"
+	"slices"
+)
+
+// Shadow runs a candidate strategy, made by f, next to the wrapped one on
+// the same inputs. Only the move of the wrapped strategy is sent; every
+// tick where the candidate's move differs is logged, and a summary at the
+// end of the game.
+//
+// The candidate runs on its own goroutine once the wrapped strategy has
+// returned, on a copy of the inputs taken before, so it neither delays the
+// move sent nor sees what the wrapped strategy changed. Ticks arriving
+// while it is still busy with an earlier one are skipped. Its panics are
+// logged and otherwise ignored.
+func Shadow(f Factory) Middleware {
+	return func(next Strategy) Strategy {
+		var (
+			shadow       = f()
+			ticks, diffs int
+			panics       int
+			skipped      int
+			// busy holds a token while the candidate runs, which also
+			// publishes its counters to whoever takes the token next.
+			busy = make(chan struct{}, 1)
+		)
+
+		w := &wrapped{next: next}
+		w.move = func(me *Player, world *World, game *Game, move *Move) {
+			select {
+			case busy <- struct{}{}:
+			default:
+				skipped++
+				next.Move(me, world, game, move)
+				return
+			}
+
+			in := snapshot(&PlayerContext{Player: me, World: world})
+			g, m := *game, *move
+			next.Move(me, world, game, move)
+			primary := *move
+
+			go func() {
+				defer func() { <-busy }()
+
+				ticks++
+				tick := in.World.TickIndex
+				if err := protect(func() { shadow.Move(in.Player, in.World, &g, &m) }); err != nil {
+					panics++
+					w.logf(LogError, "tick %d: shadow %v", tick, err)
+					return
+				}
+				if m != primary {
+					diffs++
+					w.logf(LogInfo, "tick %d: shadow move differs\n  primary: %+v\n  shadow:  %+v", tick, primary, m)
+				}
+			}()
+		}
+		w.start = func(game *Game, teamSize int) {
+			if err := startGame(shadow, game, teamSize); err != nil {
+				w.logf(LogError, "shadow Start: %v", err)
+			}
+		}
+		w.end = func(world *World, scores map[int64]int) {
+			select {
+			case busy <- struct{}{}:
+			default:
+				w.logf(LogError, "shadow is still running, skipping its End")
+				return
+			}
+			if err := endGame(shadow, world); err != nil {
+				w.logf(LogError, "shadow End: %v", err)
+			}
+			w.logf(LogInfo, "shadow differed on %d of %d ticks, panicked on %d, skipped %d", diffs, ticks, panics, skipped)
+		}
+		return w
+	}
+}
+
+// snapshot copies pc deeply enough that neither the strategy nor the
+// decoder, pooled or not, can change the copy.
+func snapshot(pc *PlayerContext) *PlayerContext {
+	me, w := *pc.Player, *pc.World
+
+	w.Players = copyAll(w.Players)
+	w.Facilities = copyAll(w.Facilities)
+	w.NewVehicles = copyAll(w.NewVehicles)
+	for _, v := range w.NewVehicles {
+		v.Groups = slices.Clone(v.Groups)
+	}
+	w.VehicleUpdates = copyAll(w.VehicleUpdates)
+	for _, u := range w.VehicleUpdates {
+		u.Groups = slices.Clone(u.Groups)
+	}
+	w.TerrainByCellXY = cloneRows(w.TerrainByCellXY)
+	w.WeatherByCellXY = cloneRows(w.WeatherByCellXY)
+
+	return &PlayerContext{Player: &me, World: &w}
+}
+
+// copyAll returns a list of copies of the elements of s.
+func copyAll[T any](s []*T) []*T {
+	if s == nil {
+		return nil
+	}
+	c := make([]*T, len(s))
+	for i, p := range s {
+		if p != nil {
+			v := *p
+			c[i] = &v
+		}
+	}
+	return c
+}
+
+func cloneRows[T any](rows [][]T) [][]T {
+	if rows == nil {
+		return nil
+	}
+	c := make([][]T, len(rows))
+	for i, r := range rows {
+		c[i] = slices.Clone(r)
+	}
+	return c
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	. "model"
+	"testing"
+	"time"
+)
+
+// clearing moves to its number of players, then clears the list.
+type clearing struct{}
+
+func (clearing) Move(me *Player, world *World, game *Game, move *Move) {
+	move.X = float64(len(world.Players))
+	world.Players = world.Players[:0]
+}
+
+// slowCounter sleeps, then reports the tick and its number of players.
+type slowCounter struct {
+	delay time.Duration
+	seen  chan [2]int
+}
+
+func (s *slowCounter) Move(me *Player, world *World, game *Game, move *Move) {
+	time.Sleep(s.delay)
+	s.seen <- [2]int{world.TickIndex, len(world.Players)}
+}
+
+func TestShadowOffCriticalPath(t *testing.T) {
+	candidate := &slowCounter{delay: 50 * time.Millisecond, seen: make(chan [2]int, 10)}
+	s := Chain(clearing{}, Shadow(func() Strategy { return candidate }))
+
+	for tick := 0; tick < 3; tick++ {
+		world := &World{TickIndex: tick, Players: []*Player{{Id: 1, Me: true}, {Id: 2}}}
+		m := newMove()
+		start := time.Now()
+		s.Move(world.Players[0], world, new(Game), m)
+		if took := time.Since(start); took >= candidate.delay {
+			t.Errorf("tick %d: Move took %v, waiting for the shadow", tick, took)
+		}
+		if m.X != 2 {
+			t.Errorf("tick %d: primary moved to %v, want 2", tick, m.X)
+		}
+	}
+
+	// Tick 0 was still running, so ticks 1 and 2 were skipped, and the
+	// shadow saw the players the primary cleared afterwards.
+	if seen := <-candidate.seen; seen != [2]int{0, 2} {
+		t.Errorf("shadow saw tick %d with %d players, want tick 0 with 2", seen[0], seen[1])
+	}
+	time.Sleep(candidate.delay)
+	select {
+	case seen := <-candidate.seen:
+		t.Errorf("shadow ran on tick %d while busy", seen[0])
+	default:
+	}
+
+	// Once idle, the shadow runs again.
+	world := &World{TickIndex: 3, Players: []*Player{{Id: 1, Me: true}, {Id: 2}}}
+	s.Move(world.Players[0], world, new(Game), newMove())
+	if seen := <-candidate.seen; seen != [2]int{3, 2} {
+		t.Errorf("shadow saw tick %d with %d players, want tick 3 with 2", seen[0], seen[1])
+	}
+}
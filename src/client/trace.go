@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bytes"
+	"codec"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// TickRange selects ticks From to To inclusive. It is given as "from:to",
+// where either bound may be omitted, as a single tick or as "all".
+type TickRange struct {
+	Enabled  bool
+	From, To int // To < 0 leaves the range open
+}
+
+func (r TickRange) String() string {
+	switch {
+	case !r.Enabled:
+		return ""
+	case r.To < 0:
+		return strconv.Itoa(r.From) + ":"
+	default:
+		return strconv.Itoa(r.From) + ":" + strconv.Itoa(r.To)
+	}
+}
+
+// Set implements flag.Value.
+func (r *TickRange) Set(s string) (err error) {
+	if s == "" {
+		*r = TickRange{}
+		return nil
+	}
+	if s == "all" {
+		*r = TickRange{Enabled: true, To: -1}
+		return nil
+	}
+
+	v := TickRange{Enabled: true, To: -1}
+	from, to, found := strings.Cut(s, ":")
+	if from != "" {
+		if v.From, err = strconv.Atoi(from); err != nil || v.From < 0 {
+			return fmt.Errorf("invalid tick range %q", s)
+		}
+	}
+	if !found {
+		v.To = v.From
+	} else if to != "" {
+		if v.To, err = strconv.Atoi(to); err != nil || v.To < v.From {
+			return fmt.Errorf("invalid tick range %q", s)
+		}
+	}
+	*r = v
+	return nil
+}
+
+// Contains reports whether tick is in the range. Messages exchanged before
+// the first tick, numbered -1, belong to ranges starting at tick 0.
+func (r TickRange) Contains(tick int) bool {
+	if !r.Enabled {
+		return false
+	}
+	if tick < 0 {
+		return r.From == 0
+	}
+	return tick >= r.From && (r.To < 0 || tick <= r.To)
+}
+
+// tracer logs the fields of the messages exchanged during the selected
+// ticks, one line per field:
+//
+//	< offset  hex-bytes  MessageType.Field = value
+//
+// with < for fields read and > for fields written. Lines are held until the
+// message is complete, since the tick of a context is only known once its
+// World has been decoded; a message that fails to decode is always logged.
+//
+// Formatting every field costs far more than decoding it, so reads are only
+// traced when the message may belong to a selected tick: the last tick read
+// or the next one. Tracing stops at World.TickIndex if the tick turns out
+// not to be selected. An untraced message that fails is logged as the raw
+// bytes kept by the client. Writes are only traced during selected ticks.
+type tracer struct {
+	ticks   TickRange
+	in, out bytes.Buffer
+	tick    int
+
+	dec  *codec.Decoder
+	enc  *codec.Encoder
+	hist *history
+	// start is the offset of the message being read; traced tells whether
+	// all of its fields so far are in.
+	start  int64
+	traced bool
+}
+
+func newTracer(ticks TickRange) *tracer {
+	return &tracer{ticks: ticks, tick: -1}
+}
+
+// beginRead decides whether to trace the next message read.
+func (t *tracer) beginRead() {
+	t.start = t.dec.Offset()
+	t.traced = t.ticks.Contains(t.tick) || t.ticks.Contains(t.tick+1)
+	if t.traced {
+		t.dec.SetTrace(t.read)
+	} else {
+		t.dec.SetTrace(nil)
+	}
+}
+
+func (t *tracer) read(offset int64, raw []byte, m codec.MessageType, field string, value any) {
+	if !t.traced {
+		return
+	}
+	if tick, ok := value.(int); ok && field == "World.TickIndex" && !t.ticks.Contains(tick) {
+		t.traced = false
+		t.in.Reset()
+		return
+	}
+	traceLine(&t.in, '<', offset, raw, m, field, value)
+}
+
+// beginWrite decides whether to trace the next message written, which
+// belongs to the last tick read.
+func (t *tracer) beginWrite() {
+	if t.ticks.Contains(t.tick) {
+		t.enc.SetTrace(t.write)
+	} else {
+		t.enc.SetTrace(nil)
+	}
+}
+
+func (t *tracer) write(offset int64, raw []byte, m codec.MessageType, field string, value any) {
+	traceLine(&t.out, '>', offset, raw, m, field, value)
+}
+
+// endRead logs the message just read if it belongs to a selected tick.
+// Messages without a tick of their own, such as GameOver, belong to the
+// last tick read, as do the messages written next.
+func (t *tracer) endRead(tick int, err error) {
+	if tick >= 0 {
+		t.tick = tick
+	}
+	switch {
+	case err != nil && !t.traced:
+		b, from := t.hist.window(t.start, t.dec.Offset())
+		log.Printf("trace tick %d: untraced message failed, bytes from offset %d\n%s", t.tick, from, hex.Dump(b))
+	case t.ticks.Contains(t.tick) || err != nil:
+		log.Printf("trace tick %d\n%s", t.tick, t.in.Bytes())
+	}
+	t.in.Reset()
+}
+
+func (t *tracer) endWrite(err error) {
+	if t.ticks.Contains(t.tick) || err != nil && t.out.Len() > 0 {
+		log.Printf("trace tick %d\n%s", t.tick, t.out.Bytes())
+	}
+	t.out.Reset()
+}
+
+// traceMaxBytes bounds the bytes dumped for a single field, which matters
+// for strings only.
+const traceMaxBytes = 8
+
+func traceLine(buf *bytes.Buffer, dir byte, offset int64, raw []byte, m codec.MessageType, field string, value any) {
+	hex := fmt.Sprintf("% x", raw)
+	if len(raw) > traceMaxBytes {
+		hex = fmt.Sprintf("% x ..", raw[:traceMaxBytes])
+	}
+	if s, ok := value.(string); ok {
+		value = strconv.Quote(s)
+	}
+	fmt.Fprintf(buf, "%c %8d  %-26s %s.%s = %v\n", dir, offset, hex, m, field, value)
+}
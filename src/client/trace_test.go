@@ -0,0 +1,30 @@
+package client
+
+import (
+	"codec"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestTraceWritesInRange checks that moves are only formatted during the
+// selected ticks, not formatted and then dropped.
+func TestTraceWritesInRange(t *testing.T) {
+	var ticks TickRange
+	if err := ticks.Set("2:3"); err != nil {
+		t.Fatal(err)
+	}
+	tr := newTracer(ticks)
+	tr.enc = codec.NewEncoder(io.Discard)
+
+	for tick := 0; tick < 5; tick++ {
+		tr.tick = tick
+		tr.beginWrite()
+		tr.enc.WriteMoveMessage(newMove())
+		got := strings.Count(tr.out.String(), "Move.Action")
+		if want := map[bool]int{false: 0, true: 1}[ticks.Contains(tick)]; got != want {
+			t.Errorf("tick %d: %d Move.Action lines, want %d", tick, got, want)
+		}
+		tr.out.Reset()
+	}
+}
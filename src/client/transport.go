@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DialURL opens the connection described by a transport URL:
+//
+//	tcp://host:port
+//	unix:///path/to/socket
+//	stdio:
+//
+// stdio: talks to the server over the standard input and output of the
+// process, so log output must go elsewhere (the default logger writes to
+// standard error). Closing it does not interrupt a pending read of standard
+// input, which only returns once the server sends data or closes its end.
+func DialURL(ctx context.Context, rawurl string, timeout time.Duration) (io.ReadWriteCloser, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{Timeout: timeout}
+
+	switch u.Scheme {
+	case "tcp":
+		return d.DialContext(ctx, "tcp", u.Host)
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		return d.DialContext(ctx, "unix", path)
+	case "stdio":
+		return stdio{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported transport %q", rawurl)
+	}
+}
+
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error) {
+	return os.Stdin.Read(p)
+}
+
+func (stdio) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+// Close closes standard output so the peer sees the end of the stream.
+// Standard input is left open: closing it would not release a blocked Read.
+func (stdio) Close() error {
+	return os.Stdout.Close()
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	. "model"
+	"strings"
+	"time"
+)
+
+// LatePolicy decides what happens to a move that arrives after its tick's
+// budget ran out.
+type LatePolicy int
+
+const (
+	// LateDiscard drops the late move. The next tick waits for the late
+	// call to return and then calls the strategy again, both within that
+	// tick's budget, so the calls after an overrun get less time.
+	LateDiscard LatePolicy = iota
+	// LateApplyNext sends the late move as the next tick's move.
+	LateApplyNext
+)
+
+var latePolicyNames = [...]string{
+	LateDiscard:   "discard",
+	LateApplyNext: "apply",
+}
+
+func (p LatePolicy) String() string {
+	if p >= 0 && int(p) < len(latePolicyNames) {
+		return latePolicyNames[p]
+	}
+	return fmt.Sprintf("LatePolicy(%d)", int(p))
+}
+
+// Set implements flag.Value.
+func (p *LatePolicy) Set(s string) error {
+	for i, name := range latePolicyNames {
+		if strings.EqualFold(s, name) {
+			*p = LatePolicy(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown late policy %q", s)
+}
+
+// watchdog runs the strategy in a goroutine and answers with an empty move
+// when it does not return within the budget. The strategy is never called
+// again while a previous call is still running.
+type watchdog struct {
+	call   func(ctx context.Context, pc *PlayerContext, g *Game) (*Move, error)
+	budget time.Duration
+	policy LatePolicy
+
+	// pending delivers the result of a call that overran its tick.
+	pending chan result
+	late    int
+}
+
+type result struct {
+	m   *Move
+	err error
+}
+
+func (w *watchdog) busy() bool {
+	return w.pending != nil
+}
+
+// move returns the move to send for pc within the budget, which covers
+// both waiting for a late call and the new call. A panic in a late call is
+// reported with the tick its move is applied to, or the next one. The call
+// gets a context derived from ctx that expires with the budget.
+func (w *watchdog) move(ctx context.Context, pc *PlayerContext, g *Game) (m *Move, late bool, err error) {
+	deadline := time.Now().Add(w.budget)
+	timer := time.NewTimer(w.budget)
+	defer timer.Stop()
+
+	if w.pending != nil {
+		select {
+		case r := <-w.pending:
+			w.pending = nil
+			if w.policy == LateApplyNext || r.err != nil {
+				return r.m, false, r.err
+			}
+		case <-timer.C:
+			w.late++
+			return newMove(), true, nil
+		}
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	done := make(chan result, 1)
+	go func() {
+		defer cancel()
+		m, err := w.call(ctx, pc, g)
+		done <- result{m, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.m, false, r.err
+	case <-timer.C:
+		w.pending = done
+		w.late++
+		return newMove(), true, nil
+	}
+}
+
+// wait waits up to the budget for a late call and reports whether it
+// returned. Its result is dropped.
+func (w *watchdog) wait() bool {
+	timer := time.NewTimer(w.budget)
+	defer timer.Stop()
+
+	select {
+	case <-w.pending:
+		w.pending = nil
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// detach returns a context to decode the next tick into while a strategy
+// call still reads pc. Decoding replaces the slices of the World rather
+// than modifying them, so a shallow copy is enough, except for the vehicle
+// updates which the decoder reuses in pooled mode.
+func detach(pc *PlayerContext) *PlayerContext {
+	w := *pc.World
+	w.VehicleUpdates = nil
+	return &PlayerContext{Player: new(Player), World: &w}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	. "model"
+	"testing"
+	"time"
+)
+
+// TestWatchdogTickBudget has a strategy overrun the budget on one tick and
+// then take most of it on the next ones: waiting for the late call must not
+// give those ticks more than one budget.
+func TestWatchdogTickBudget(t *testing.T) {
+	const budget = 50 * time.Millisecond
+	durations := []time.Duration{10, 90, 45, 45, 10}
+
+	w := &watchdog{budget: budget, policy: LateDiscard}
+	w.call = func(ctx context.Context, pc *PlayerContext, g *Game) (*Move, error) {
+		time.Sleep(durations[pc.World.TickIndex] * time.Millisecond)
+		m := newMove()
+		m.X = float64(pc.World.TickIndex + 1)
+		return m, nil
+	}
+
+	for tick := range durations {
+		pc := &PlayerContext{Player: new(Player), World: &World{TickIndex: tick}}
+		start := time.Now()
+		m, late, err := w.move(context.Background(), pc, new(Game))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if took := time.Since(start); took > budget+budget/2 {
+			t.Errorf("tick %d took %v with a %v budget", tick, took, budget)
+		}
+		if late != (m.X != float64(tick+1)) {
+			t.Errorf("tick %d: late %v, move %+v", tick, late, *m)
+		}
+		if short := durations[tick] < 45; short && late {
+			t.Errorf("tick %d: late, want the move of a short call", tick)
+		}
+	}
+	if w.late < 1 || w.late > 3 {
+		t.Errorf("%d late ticks, want 1 to 3", w.late)
+	}
+}
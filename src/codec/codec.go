@@ -0,0 +1,97 @@
+// Package codec encodes and decodes the messages of the game protocol in
+// both directions, so the client, the mock server and the tools built on
+// recorded sessions share one implementation.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var ByteOrder = binary.LittleEndian
+
+type MessageType byte
+
+const (
+	Message_GameOver MessageType = iota + 1
+	Message_AuthenticationToken
+	Message_TeamSize
+	Message_ProtocolVersion
+	Message_GameContext
+	Message_PlayerContext
+	Message_Move
+)
+
+var messageNames = [...]string{
+	Message_GameOver:            "GameOver",
+	Message_AuthenticationToken: "AuthenticationToken",
+	Message_TeamSize:            "TeamSize",
+	Message_ProtocolVersion:     "ProtocolVersion",
+	Message_GameContext:         "GameContext",
+	Message_PlayerContext:       "PlayerContext",
+	Message_Move:                "Move",
+}
+
+// known reports whether m is a message type of the protocol. An unknown
+// type where a message should start means the previous message was longer
+// or shorter than its schema.
+func (m MessageType) known() bool {
+	return int(m) < len(messageNames) && messageNames[m] != ""
+}
+
+func (m MessageType) String() string {
+	if m.known() {
+		return messageNames[m]
+	}
+	return "MessageType(" + strconv.Itoa(int(m)) + ")"
+}
+
+const Version int = 3
+
+// Markers preceding a Player or Facility record: absent, sent in full, or
+// unchanged since it was last sent and identified by Id only.
+const (
+	recordNone   byte = 0
+	recordFull   byte = 1
+	recordCached byte = 127
+)
+
+var (
+	ErrGameOver = errors.New("game over")
+	// ErrWrongType reports a message other than the one expected, or an
+	// opcode that no message has.
+	ErrWrongType = errors.New("wrong message type")
+)
+
+// ProtocolError describes a failure to read or write a single field of a
+// protocol message. Offset counts bytes from the start of the stream in the
+// direction given by Op.
+type ProtocolError struct {
+	Op      string
+	Message MessageType
+	Field   string
+	Offset  int64
+	Err     error
+}
+
+// Error names the field within its message, or alone when it precedes any
+// message, such as the first opcode of a stream.
+func (e *ProtocolError) Error() string {
+	switch {
+	case e.Message == 0:
+		return fmt.Sprintf("%s %s at offset %d: %v", e.Op, e.Field, e.Offset, e.Err)
+	case e.Field == "":
+		return fmt.Sprintf("%s %s at offset %d: %v", e.Op, e.Message, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s %s.%s at offset %d: %v", e.Op, e.Message, e.Field, e.Offset, e.Err)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// Trace receives every field read or written: its offset in the stream,
+// its bytes on the wire and its value. raw is only valid during the call.
+type Trace func(offset int64, raw []byte, m MessageType, field string, value any)
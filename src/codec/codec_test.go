@@ -0,0 +1,229 @@
+package codec
+
+import (
+	"bytes"
+	. "model"
+	"reflect"
+	"testing"
+)
+
+// fill sets every numeric and boolean field of the struct v points to,
+// embedded structs included, to a distinct non-zero value. Byte-sized
+// enums stay small so that they remain valid.
+func fill(v any) {
+	n := 0
+	var walk func(reflect.Value)
+	walk = func(s reflect.Value) {
+		for i := 0; i < s.NumField(); i++ {
+			f := s.Field(i)
+			n++
+			switch f.Kind() {
+			case reflect.Struct:
+				walk(f)
+			case reflect.Bool:
+				f.SetBool(true)
+			case reflect.Uint8:
+				f.SetUint(uint64(1 + n%4))
+			case reflect.Int, reflect.Int64:
+				f.SetInt(int64(n))
+			case reflect.Float64:
+				f.SetFloat(float64(n) + 0.25)
+			}
+		}
+	}
+	walk(reflect.ValueOf(v).Elem())
+}
+
+// zeroFields returns the names of the fields of the struct v points to
+// that are still zero.
+func zeroFields(v any) []string {
+	var names []string
+	s := reflect.ValueOf(v).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		if s.Field(i).IsZero() {
+			names = append(names, s.Type().Field(i).Name)
+		}
+	}
+	return names
+}
+
+func TestGameRoundTrip(t *testing.T) {
+	g := new(Game)
+	fill(g)
+	if zero := zeroFields(g); len(zero) > 0 {
+		t.Fatalf("fill left fields zero: %v", zero)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.WriteGameContextMessage(g)
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewDecoder(&buf).ReadGameContextMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, g) {
+		t.Errorf("got %+v\nwant %+v", *got, *g)
+	}
+}
+
+// TestSchemaVersions plays a server revision 4 that adds RandomSeed and
+// drops WorldWidth, on a schema reduced to three fields.
+func TestSchemaVersions(t *testing.T) {
+	schema := Schema[Game]{
+		{Name: "TickCount", Ref: func(g *Game) any { return &g.TickCount }},
+		{Name: "RandomSeed", Since: 4, Ref: func(g *Game) any { return &g.RandomSeed }},
+		{Name: "WorldWidth", Until: 3, Ref: func(g *Game) any { return &g.WorldWidth }},
+	}
+	g := &Game{TickCount: 7, RandomSeed: 9, WorldWidth: 1.5}
+
+	for _, tc := range []struct {
+		version int
+		want    Game
+	}{
+		{3, Game{TickCount: 7, WorldWidth: 1.5}},
+		{4, Game{TickCount: 7, RandomSeed: 9}},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.game = schema.For(tc.version)
+		e.WriteGameContextMessage(g)
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		// opcode, presence flag, TickCount and an 8-byte field
+		if n := buf.Len(); n != 1+1+4+8 {
+			t.Errorf("version %d: %d bytes written", tc.version, n)
+		}
+
+		d := NewDecoder(&buf)
+		d.game = schema.For(tc.version)
+		got, err := d.ReadGameContextMessage()
+		if err != nil {
+			t.Fatalf("version %d: %v", tc.version, err)
+		}
+		if *got != tc.want {
+			t.Errorf("version %d: got %+v, want %+v", tc.version, *got, tc.want)
+		}
+	}
+}
+
+func newVehicle(id int64) *Vehicle {
+	v := new(Vehicle)
+	fill(v)
+	v.Id, v.PlayerId, v.Groups = id, 1, []int{1, 3}
+	return v
+}
+
+// markers records the Player and Facility record markers a decoder reads.
+func markers(d *Decoder) *[]string {
+	var seen []string
+	d.SetTrace(func(_ int64, _ []byte, _ MessageType, field string, value any) {
+		if b, ok := value.(byte); ok && (field == "Player" || field == "Facility") {
+			seen = append(seen, field+map[byte]string{recordNone: " none", recordFull: " full", recordCached: " cached"}[b])
+		}
+	})
+	return &seen
+}
+
+func TestPlayerContextRoundTrip(t *testing.T) {
+	me, enemy := &Player{Id: 1, Me: true, Score: 10}, &Player{Id: 2, Score: 20, NextNuclearStrikeX: 3.5}
+	f1, f2 := &Facility{Id: 5, OwnerPlayerId: -1, Left: 64}, &Facility{Id: 6, OwnerPlayerId: 1, CapturePoints: 100}
+
+	update := new(VehicleUpdate)
+	fill(update)
+	update.Groups = []int{2}
+
+	tick0 := &PlayerContext{Player: me, World: &World{
+		TickIndex: 0, TickCount: 20000, Width: 1024, Height: 1024,
+		Players:         []*Player{me, enemy},
+		NewVehicles:     []*Vehicle{newVehicle(1), newVehicle(2)},
+		VehicleUpdates:  []*VehicleUpdate{update},
+		TerrainByCellXY: [][]Terrain{{Terrain_Plain, Terrain_Swamp, Terrain_Forest}, {Terrain_Forest, Terrain_Plain, Terrain_Plain}},
+		WeatherByCellXY: [][]Weather{{Weather_Clear, Weather_Cloud, Weather_Rain}, {Weather_Rain, Weather_Clear, Weather_Clear}},
+		Facilities:      []*Facility{f1, f2},
+	}}
+
+	// The next tick keeps me and f1 unchanged, so they are sent as cached
+	// records, while enemy and f2 change and are sent in full.
+	enemy2, f22 := *enemy, *f2
+	enemy2.Score++
+	f22.CapturePoints--
+	tick1 := &PlayerContext{Player: me, World: &World{
+		TickIndex: 1, TickCount: 20000, Width: 1024, Height: 1024,
+		Players:        []*Player{me, &enemy2},
+		VehicleUpdates: []*VehicleUpdate{{Id: 1, X: 2, Y: 3, Durability: 50, Groups: []int{1}}},
+		Facilities:     []*Facility{f1, &f22},
+	}}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.WritePlayerContextMessage(tick0)
+	e.WritePlayerContextMessage(tick1)
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(&buf)
+	seen := markers(d)
+	for i, want := range []*PlayerContext{tick0, tick1} {
+		*seen = nil
+		got := &PlayerContext{Player: new(Player), World: new(World)}
+		if err := d.ReadContextMessage(got); err != nil {
+			t.Fatalf("tick %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("tick %d: got %+v\nwant %+v", i, *got.World, *want.World)
+		}
+	}
+
+	want := []string{"Player cached", "Player cached", "Player full", "Facility cached", "Facility full"}
+	if !reflect.DeepEqual(*seen, want) {
+		t.Errorf("tick 1 markers: got %v, want %v", *seen, want)
+	}
+}
+
+func TestMessagesRoundTrip(t *testing.T) {
+	m := new(Move)
+	fill(m)
+	if zero := zeroFields(m); len(zero) > 0 {
+		t.Fatalf("fill left fields zero: %v", zero)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.WriteTokenMessage("0123456789abcdef")
+	e.WriteProtocolVersionMessage(Version)
+	e.WriteTeamSizeMessage(2)
+	e.WriteMoveMessage(m)
+	e.WriteGameOverMessage()
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(&buf)
+	for _, want := range []struct {
+		m MessageType
+		v any
+	}{
+		{Message_AuthenticationToken, "0123456789abcdef"},
+		{Message_ProtocolVersion, Version},
+		{Message_TeamSize, 2},
+		{Message_Move, m},
+		{Message_GameOver, nil},
+	} {
+		typ, v, err := d.ReadMessage()
+		if err != nil {
+			t.Fatalf("%s: %v", want.m, err)
+		}
+		if typ != want.m || !reflect.DeepEqual(v, want.v) {
+			t.Errorf("got %s %+v, want %s %+v", typ, v, want.m, want.v)
+		}
+	}
+	if d.Offset() != e.Offset() {
+		t.Errorf("read %d bytes, wrote %d", d.Offset(), e.Offset())
+	}
+}
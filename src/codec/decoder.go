@@ -0,0 +1,761 @@
+package codec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	. "model"
+	"slices"
+)
+
+// readBufferSize is large enough to hold a typical tick, so that fields
+// can be decoded in place from the buffer.
+const readBufferSize = 1 << 16
+
+// Decoder reads protocol messages. Players and facilities are cached by Id
+// so that records the server marks as unchanged can be resolved.
+//
+// The first error is sticky: once it happens every read returns a zero
+// value and Err reports the error.
+type Decoder struct {
+	reader *bufio.Reader
+	tap    io.Writer
+	trace  Trace
+
+	players    map[int64]*Player
+	facilities map[int64]*Facility
+
+	// playerOrder and facilityOrder hold the Ids of the last lists sent in
+	// full, so that lists rebuilt from the caches keep the server order.
+	playerOrder, facilityOrder []int64
+
+	// explicit holds the limits set with SetLimits, limits the ones in
+	// force: explicit ones completed from the Game or the defaults.
+	explicit, limits Limits
+
+	version int
+	game    Schema[Game]
+	world   Schema[World]
+
+	pooled bool
+	// spare keeps the updates of a World that got none, for the next one.
+	spare []*VehicleUpdate
+
+	err error
+	msg MessageType
+	pos int64
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	d := &Decoder{
+		reader:     bufio.NewReaderSize(r, readBufferSize),
+		players:    make(map[int64]*Player),
+		facilities: make(map[int64]*Facility),
+		limits:     DefaultLimits(),
+	}
+	d.SetVersion(Version)
+	return d
+}
+
+// SetVersion selects the message layouts of protocol version v.
+func (d *Decoder) SetVersion(v int) error {
+	if !Supported(v) {
+		return versionError(v)
+	}
+	d.version, d.game, d.world = v, GameSchema.For(v), WorldSchema.For(v)
+	return nil
+}
+
+func (d *Decoder) Version() int {
+	return d.version
+}
+
+// SetPooled makes ReadWorld decode the vehicle updates into those already
+// held by the World, reusing the VehicleUpdate structs, their Groups and the
+// slice itself, instead of allocating new ones every tick.
+//
+// The updates of a World are then only valid until the next ReadWorld into
+// it: whoever needs one longer must copy it, Groups included.
+func (d *Decoder) SetPooled(on bool) {
+	d.pooled = on
+}
+
+// SetLimits overrides the limits derived from the Game. Unset fields of l
+// keep being derived.
+func (d *Decoder) SetLimits(l Limits) {
+	d.explicit = l
+	d.limits = l.Or(DefaultLimits())
+}
+
+func (d *Decoder) Limits() Limits {
+	return d.limits
+}
+
+// Reset switches the decoder to read from r, discarding buffered input but
+// keeping the caches, the offset and any error.
+func (d *Decoder) Reset(r io.Reader) {
+	d.reader.Reset(r)
+}
+
+// SetTap makes the decoder copy every consumed byte to w.
+func (d *Decoder) SetTap(w io.Writer) {
+	d.tap = w
+}
+
+// SetTrace makes the decoder report every field it reads to t.
+func (d *Decoder) SetTrace(t Trace) {
+	d.trace = t
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Offset returns the number of bytes consumed so far.
+func (d *Decoder) Offset() int64 {
+	return d.pos
+}
+
+func (d *Decoder) fail(m MessageType, field string, offset int64, err error) {
+	if d.err == nil {
+		d.err = &ProtocolError{Op: "read", Message: m, Field: field, Offset: offset, Err: err}
+	}
+}
+
+// ReadMessage reads a message of any type and returns its body as the
+// Read*Message method of that type would: a string for the token, an int
+// for the version and the team size, a *Game, a *PlayerContext or a *Move,
+// and nil for GameOver.
+func (d *Decoder) ReadMessage() (MessageType, any, error) {
+	var v any
+
+	switch m := d.ReadOpcode(); m {
+	case Message_AuthenticationToken:
+		v = d.readString("Token")
+	case Message_ProtocolVersion:
+		v = d.readInt("Version")
+	case Message_TeamSize:
+		v = d.readTeamSize()
+	case Message_GameContext:
+		v = d.ReadGame()
+	case Message_PlayerContext:
+		pc := &PlayerContext{Player: new(Player), World: new(World)}
+		d.ReadPlayerContext(pc)
+		v = pc
+	case Message_Move:
+		v = d.ReadMove()
+	}
+
+	if d.err != nil {
+		return d.msg, nil, d.err
+	}
+	return d.msg, v, nil
+}
+
+// ReadGameContextMessage reads a GameContext message.
+func (d *Decoder) ReadGameContextMessage() (*Game, error) {
+	if err := d.Expect(Message_GameContext); err != nil {
+		return nil, err
+	}
+	g := d.ReadGame()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return g, nil
+}
+
+// ReadGame also derives the decoder limits from the decoded constants.
+func (d *Decoder) ReadGame() *Game {
+	if !d.readBool("Game") {
+		return nil
+	}
+
+	g := new(Game)
+	readFields(d, d.game, g)
+	if d.err == nil {
+		d.limits = d.explicit.Or(LimitsFor(g))
+	}
+	return g
+}
+
+// ReadContextMessage reads the message the server sends at every tick into
+// pc. It returns ErrGameOver at the end of the game and a ProtocolError
+// wrapping ErrWrongType, without consuming anything beyond the opcode, for
+// any other message.
+func (d *Decoder) ReadContextMessage(pc *PlayerContext) error {
+	switch m := d.ReadOpcode(); m {
+	case Message_GameOver:
+		return ErrGameOver
+	case Message_PlayerContext:
+		d.ReadPlayerContext(pc)
+		return d.err
+	default:
+		if d.err != nil {
+			return d.err
+		}
+		return &ProtocolError{Op: "read", Message: m, Field: "opcode", Offset: d.pos - 1, Err: ErrWrongType}
+	}
+}
+
+// ReadPlayerContext decodes into the Player and World of pc, which must not
+// be nil.
+func (d *Decoder) ReadPlayerContext(pc *PlayerContext) {
+	if d.readBool("PlayerContext") {
+		if me := d.ReadPlayer(); me != nil {
+			*pc.Player = *me
+		}
+		d.ReadWorld(pc.World)
+	}
+}
+
+// ReadPlayer returns nil for an absent player. A cached player is looked up
+// among those decoded earlier.
+func (d *Decoder) ReadPlayer() *Player {
+	switch d.readByte("Player") {
+	case recordNone:
+		return nil
+	case recordCached:
+		return d.players[d.readInt64("Player.Id")]
+	default:
+		p := new(Player)
+		p.Id = d.readInt64("Player.Id")
+		p.Me = d.readBool("Player.Me")
+		p.StrategyCrashed = d.readBool("Player.StrategyCrashed")
+		p.Score = d.readInt("Player.Score")
+		p.RemainingActionCooldownTicks = d.readInt("Player.RemainingActionCooldownTicks")
+		p.RemainingNuclearStrikeCooldownTicks = d.readInt("Player.RemainingNuclearStrikeCooldownTicks")
+		p.NextNuclearStrikeVehicleId = d.readInt64("Player.NextNuclearStrikeVehicleId")
+		p.NextNuclearStrikeTickIndex = d.readInt("Player.NextNuclearStrikeTickIndex")
+		p.NextNuclearStrikeX = d.readFloat64("Player.NextNuclearStrikeX")
+		p.NextNuclearStrikeY = d.readFloat64("Player.NextNuclearStrikeY")
+
+		if d.err != nil {
+			return nil
+		}
+
+		d.players[p.Id] = p
+
+		return p
+	}
+}
+
+func (d *Decoder) ReadWorld(w *World) {
+	if d.readBool("World") {
+		readFields(d, d.world, w)
+	}
+}
+
+func (d *Decoder) ReadMoveMessage() (*Move, error) {
+	if err := d.Expect(Message_Move); err != nil {
+		return nil, err
+	}
+	m := d.ReadMove()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return m, nil
+}
+
+func (d *Decoder) ReadMove() *Move {
+	if !d.readBool("Move") {
+		return nil
+	}
+
+	m := new(Move)
+	m.Action = ActionType(d.readByte("Action"))
+	m.Group = d.readInt("Group")
+	m.Left = d.readFloat64("Left")
+	m.Top = d.readFloat64("Top")
+	m.Right = d.readFloat64("Right")
+	m.Bottom = d.readFloat64("Bottom")
+	m.X = d.readFloat64("X")
+	m.Y = d.readFloat64("Y")
+	m.Angle = d.readFloat64("Angle")
+	m.Factor = d.readFloat64("Factor")
+	m.MaxSpeed = d.readFloat64("MaxSpeed")
+	m.MaxAngularSpeed = d.readFloat64("MaxAngularSpeed")
+	m.Type = VehicleType(d.readByte("Type"))
+	m.FacilityId = d.readInt64("FacilityId")
+	m.VehicleId = d.readInt64("VehicleId")
+
+	return m
+}
+
+func (d *Decoder) readWeather() (weather [][]Weather) {
+	for i := d.readLength("World.WeatherByCellXY", d.limits.MaxCells); i > 0 && d.err == nil; i-- {
+		var slice []Weather
+		for j := d.readLength("World.WeatherByCellXY", d.limits.MaxCells); j > 0 && d.err == nil; j-- {
+			slice = append(slice, Weather(d.readByte("World.WeatherByCellXY")))
+		}
+		weather = append(weather, slice)
+	}
+
+	return
+}
+
+func (d *Decoder) readTerrains() (terrain [][]Terrain) {
+	for i := d.readLength("World.TerrainByCellXY", d.limits.MaxCells); i > 0 && d.err == nil; i-- {
+		var slice []Terrain
+		for j := d.readLength("World.TerrainByCellXY", d.limits.MaxCells); j > 0 && d.err == nil; j-- {
+			slice = append(slice, Terrain(d.readByte("World.TerrainByCellXY")))
+		}
+		terrain = append(terrain, slice)
+	}
+	return
+}
+
+// ReadFacility returns nil for an absent facility. A cached facility is
+// looked up among those decoded earlier.
+func (d *Decoder) ReadFacility() *Facility {
+	switch d.readByte("Facility") {
+	case recordNone:
+		return nil
+	case recordCached:
+		return d.facilities[d.readInt64("Facility.Id")]
+	default:
+		f := new(Facility)
+		f.Id = d.readInt64("Facility.Id")
+		f.FacilityType = FacilityType(d.readByte("Facility.FacilityType"))
+		f.OwnerPlayerId = d.readInt64("Facility.OwnerPlayerId")
+		f.Left = d.readFloat64("Facility.Left")
+		f.Top = d.readFloat64("Facility.Top")
+		f.CapturePoints = d.readFloat64("Facility.CapturePoints")
+		f.VehicleType = VehicleType(d.readByte("Facility.VehicleType"))
+		f.ProductionProgress = d.readInt("Facility.ProductionProgress")
+
+		if d.err != nil {
+			return nil
+		}
+
+		d.facilities[f.Id] = f
+
+		return f
+	}
+}
+
+// ReadVehicleUpdate decodes into v and reports whether an update was present.
+func (d *Decoder) ReadVehicleUpdate(v *VehicleUpdate) bool {
+	if d.readBool("VehicleUpdate") {
+		v.Id = d.readInt64("VehicleUpdate.Id")
+		v.X = d.readFloat64("VehicleUpdate.X")
+		v.Y = d.readFloat64("VehicleUpdate.Y")
+		v.Durability = d.readInt("VehicleUpdate.Durability")
+		v.RemainingAttackCooldownTicks = d.readInt("VehicleUpdate.RemainingAttackCooldownTicks")
+		v.Selected = d.readBool("VehicleUpdate.Selected")
+		v.Groups = d.readIntArray("VehicleUpdate.Groups", d.recycle(v.Groups))
+
+		return d.err == nil
+	}
+
+	return false
+}
+
+// ReadVehicle decodes into v and reports whether a vehicle was present.
+func (d *Decoder) ReadVehicle(v *Vehicle) bool {
+	if d.readBool("Vehicle") {
+		v.Id = d.readInt64("Vehicle.Id")
+		v.X = d.readFloat64("Vehicle.X")
+		v.Y = d.readFloat64("Vehicle.Y")
+		v.Radius = d.readFloat64("Vehicle.Radius")
+		v.PlayerId = d.readInt64("Vehicle.PlayerId")
+		v.Durability = d.readInt("Vehicle.Durability")
+		v.MaxDurability = d.readInt("Vehicle.MaxDurability")
+		v.MaxSpeed = d.readFloat64("Vehicle.MaxSpeed")
+		v.VisionRange = d.readFloat64("Vehicle.VisionRange")
+		v.SquaredVisionRange = d.readFloat64("Vehicle.SquaredVisionRange")
+		v.GroundAttackRange = d.readFloat64("Vehicle.GroundAttackRange")
+		v.SquaredGroundAttackRange = d.readFloat64("Vehicle.SquaredGroundAttackRange")
+		v.AerialAttackRange = d.readFloat64("Vehicle.AerialAttackRange")
+		v.SquaredAerialAttackRange = d.readFloat64("Vehicle.SquaredAerialAttackRange")
+		v.GroundDamage = d.readInt("Vehicle.GroundDamage")
+		v.AerialDamage = d.readInt("Vehicle.AerialDamage")
+		v.GroundDefence = d.readInt("Vehicle.GroundDefence")
+		v.AerialDefence = d.readInt("Vehicle.AerialDefence")
+		v.AttackCooldownTicks = d.readInt("Vehicle.AttackCooldownTicks")
+		v.RemainingAttackCooldownTicks = d.readInt("Vehicle.RemainingAttackCooldownTicks")
+		v.Type = VehicleType(d.readByte("Vehicle.Type"))
+		v.Aerial = d.readBool("Vehicle.Aerial")
+		v.Selected = d.readBool("Vehicle.Selected")
+		v.Groups = d.readIntArray("Vehicle.Groups", nil)
+
+		return d.err == nil
+	}
+
+	return false
+}
+
+// Minimal wire sizes of list entries, used to bound preallocation.
+const (
+	vehicleSize       = 136
+	vehicleUpdateSize = 38
+)
+
+// readVehiclesUpdate decodes the updates into slabs of structs rather than
+// allocating each one separately. In pooled mode the structs of prev, the
+// updates of the previous tick, are used first.
+func (d *Decoder) readVehiclesUpdate(prev []*VehicleUpdate) (updates []*VehicleUpdate) {
+	l := d.readLength("World.VehicleUpdates", d.limits.MaxVehicles)
+	if d.pooled {
+		if prev == nil {
+			prev, d.spare = d.spare, nil
+		}
+		updates = prev[:0]
+	}
+	if l <= 0 {
+		if cap(updates) > 0 {
+			d.spare = updates
+		}
+		return nil
+	}
+
+	if cap(updates) == 0 {
+		updates = make([]*VehicleUpdate, 0, d.capacity(l, vehicleUpdateSize))
+	}
+
+	var slab []VehicleUpdate
+	for ; l > 0 && d.err == nil; l-- {
+		var v *VehicleUpdate
+		if n := len(updates); n < cap(updates) {
+			v = updates[:n+1][n]
+		}
+		if v != nil {
+			if d.ReadVehicleUpdate(v) {
+				updates = append(updates, v)
+			}
+			continue
+		}
+
+		if len(slab) == cap(slab) {
+			slab = make([]VehicleUpdate, 0, d.capacity(l, vehicleUpdateSize))
+		}
+		slab = slab[:len(slab)+1]
+		if v := &slab[len(slab)-1]; d.ReadVehicleUpdate(v) {
+			updates = append(updates, v)
+		} else {
+			slab = slab[:len(slab)-1]
+		}
+	}
+	return
+}
+
+func (d *Decoder) readFacilities() (facilities []*Facility) {
+	if l := d.readLength("World.Facilities", d.limits.MaxFacilities); l > 0 {
+		d.facilityOrder = d.facilityOrder[:0]
+		for ; l > 0 && d.err == nil; l-- {
+			if f := d.ReadFacility(); f != nil {
+				facilities = append(facilities, f)
+				d.facilityOrder = append(d.facilityOrder, f.Id)
+			}
+		}
+	} else {
+		facilities = cachedList(d.facilities, d.facilityOrder)
+	}
+
+	return
+}
+
+func (d *Decoder) readVehicles() (vehicles []*Vehicle) {
+	l := d.readLength("World.NewVehicles", d.limits.MaxVehicles)
+	if l <= 0 {
+		return
+	}
+
+	vehicles = make([]*Vehicle, 0, d.capacity(l, vehicleSize))
+
+	var slab []Vehicle
+	for ; l > 0 && d.err == nil; l-- {
+		if len(slab) == cap(slab) {
+			slab = make([]Vehicle, 0, d.capacity(l, vehicleSize))
+		}
+		slab = slab[:len(slab)+1]
+		if v := &slab[len(slab)-1]; d.ReadVehicle(v) {
+			vehicles = append(vehicles, v)
+		} else {
+			slab = slab[:len(slab)-1]
+		}
+	}
+	return
+}
+
+func (d *Decoder) readPlayers() (players []*Player) {
+	if l := d.readLength("World.Players", d.limits.MaxPlayers); l > 0 {
+		d.playerOrder = d.playerOrder[:0]
+		for ; l > 0 && d.err == nil; l-- {
+			if p := d.ReadPlayer(); p != nil {
+				players = append(players, p)
+				d.playerOrder = append(d.playerOrder, p.Id)
+			}
+		}
+	} else {
+		players = cachedList(d.players, d.playerOrder)
+	}
+
+	return
+}
+
+// cachedList returns the cached entries in the order of the last full
+// list, followed by entries never listed, such as a player only sent as
+// the context owner, by Id. Ranging over the map instead would shuffle the
+// list between runs.
+func cachedList[T any](cache map[int64]*T, order []int64) []*T {
+	if len(cache) == 0 {
+		return nil
+	}
+
+	list := make([]*T, 0, len(cache))
+	for _, id := range order {
+		list = append(list, cache[id])
+	}
+	if len(list) == len(cache) {
+		return list
+	}
+
+	var rest []int64
+	for id := range cache {
+		if !slices.Contains(order, id) {
+			rest = append(rest, id)
+		}
+	}
+	slices.Sort(rest)
+	for _, id := range rest {
+		list = append(list, cache[id])
+	}
+	return list
+}
+
+func (d *Decoder) ReadTeamSizeMessage() (int, error) {
+	if err := d.Expect(Message_TeamSize); err != nil {
+		return 0, err
+	}
+	size := d.readTeamSize()
+	return size, d.err
+}
+
+// readTeamSize reads a team size, which must be at least 1.
+func (d *Decoder) readTeamSize() int {
+	offset := d.pos
+	n := d.readLength("TeamSize", d.limits.MaxTeamSize)
+	if d.err == nil && n < 1 {
+		d.fail(d.msg, "TeamSize", offset, fmt.Errorf("invalid team size %d", n))
+		return 0
+	}
+	return n
+}
+
+func (d *Decoder) ReadTokenMessage() (string, error) {
+	if err := d.Expect(Message_AuthenticationToken); err != nil {
+		return "", err
+	}
+	token := d.readString("Token")
+	return token, d.err
+}
+
+func (d *Decoder) ReadProtocolVersionMessage() (int, error) {
+	if err := d.Expect(Message_ProtocolVersion); err != nil {
+		return 0, err
+	}
+	ver := d.readInt("Version")
+	return ver, d.err
+}
+
+// ReadOpcode reads the type of the next message. Failures, including the
+// end of the stream, are reported under the previous message, since no
+// other one has started.
+func (d *Decoder) ReadOpcode() MessageType {
+	prev := d.msg
+	m := d.readOpcode()
+	if d.err == nil && !m.known() {
+		d.fail(prev, "opcode", d.pos-1, d.unknown(m))
+	}
+	d.msg = m
+	return m
+}
+
+func (d *Decoder) mismatch() error {
+	return fmt.Errorf("%w %d", ErrVersionMismatch, d.version)
+}
+
+// unknown reports an opcode that no message of the protocol has.
+func (d *Decoder) unknown(m MessageType) error {
+	return fmt.Errorf("%w: %s is unknown in protocol version %d", ErrWrongType, m, d.version)
+}
+
+// readIntArray decodes into the storage of arr, if any. An empty array is
+// nil, as without pooling, even if that drops the storage.
+func (d *Decoder) readIntArray(field string, arr []int) []int {
+	ln := d.readLength(field, d.limits.MaxGroups)
+	if ln <= 0 {
+		return nil
+	}
+	if arr = arr[:0]; cap(arr) == 0 {
+		arr = make([]int, 0, d.capacity(ln, 4))
+	}
+	for ; ln > 0 && d.err == nil; ln-- {
+		arr = append(arr, d.readInt(field))
+	}
+	return arr
+}
+
+// recycle returns the storage of s for reuse in pooled mode.
+func (d *Decoder) recycle(s []int) []int {
+	if d.pooled {
+		return s
+	}
+	return nil
+}
+
+// readLength reads the length of a list and fails if it exceeds max.
+// Negative lengths denote absent lists and are returned as is.
+func (d *Decoder) readLength(field string, max int) int {
+	offset := d.pos
+	n := d.readInt(field)
+	if n > max {
+		d.fail(d.msg, field, offset, fmt.Errorf("%w: %d > %d", ErrTooLong, n, max))
+		return 0
+	}
+	return n
+}
+
+// capacity limits the preallocation for n items of at least size bytes
+// each to what is already buffered, so a bogus length cannot make the
+// client allocate memory the stream could never fill.
+func (d *Decoder) capacity(n, size int) int {
+	if max := d.reader.Buffered()/size + 1; n > max {
+		return max
+	}
+	return n
+}
+
+// peek returns the next n bytes of the stream without consuming them.
+// The slice is valid until consume is called.
+func (d *Decoder) peek(field string, n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	b, err := d.reader.Peek(n)
+	if err != nil {
+		if err == io.EOF && len(b) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		d.fail(d.msg, field, d.pos, err)
+		return nil
+	}
+	return b
+}
+
+func (d *Decoder) consume(b []byte) {
+	if d.tap != nil {
+		d.tap.Write(b)
+	}
+	d.reader.Discard(len(b))
+	d.pos += int64(len(b))
+}
+
+// The primitives below check d.trace before calling it so that values are
+// not boxed when tracing is off.
+
+func (d *Decoder) readInt(field string) int {
+	if b := d.peek(field, 4); b != nil {
+		v := int(int32(ByteOrder.Uint32(b)))
+		if d.trace != nil {
+			d.trace(d.pos, b, d.msg, field, v)
+		}
+		d.consume(b)
+		return v
+	}
+	return 0
+}
+
+func (d *Decoder) readInt64(field string) int64 {
+	if b := d.peek(field, 8); b != nil {
+		v := int64(ByteOrder.Uint64(b))
+		if d.trace != nil {
+			d.trace(d.pos, b, d.msg, field, v)
+		}
+		d.consume(b)
+		return v
+	}
+	return 0
+}
+
+func (d *Decoder) readFloat64(field string) float64 {
+	if b := d.peek(field, 8); b != nil {
+		v := math.Float64frombits(ByteOrder.Uint64(b))
+		if d.trace != nil {
+			d.trace(d.pos, b, d.msg, field, v)
+		}
+		d.consume(b)
+		return v
+	}
+	return 0
+}
+
+func (d *Decoder) readBool(field string) bool {
+	if b := d.peek(field, 1); b != nil {
+		v := b[0] != 0
+		if d.trace != nil {
+			d.trace(d.pos, b, d.msg, field, v)
+		}
+		d.consume(b)
+		return v
+	}
+	return false
+}
+
+func (d *Decoder) readByte(field string) byte {
+	if b := d.peek(field, 1); b != nil {
+		v := b[0]
+		if d.trace != nil {
+			d.trace(d.pos, b, d.msg, field, v)
+		}
+		d.consume(b)
+		return v
+	}
+	return 0
+}
+
+// readOpcode reads a message type, traced under its own name.
+func (d *Decoder) readOpcode() MessageType {
+	if b := d.peek("opcode", 1); b != nil {
+		m := MessageType(b[0])
+		if d.trace != nil {
+			d.trace(d.pos, b, m, "opcode", m)
+		}
+		d.consume(b)
+		return m
+	}
+	return 0
+}
+
+// Expect reads an opcode and fails unless it is m.
+func (d *Decoder) Expect(m MessageType) error {
+	d.msg = m
+	if b := d.readOpcode(); d.err == nil && !b.known() {
+		d.fail(m, "opcode", d.pos-1, d.unknown(b))
+	} else if d.err == nil && b != m {
+		d.fail(m, "opcode", d.pos-1, fmt.Errorf("%w: got %s", ErrWrongType, b))
+	}
+	return d.err
+}
+
+func (d *Decoder) readString(field string) string {
+	l := d.readLength(field, d.limits.MaxString)
+	if d.err != nil || l <= 0 {
+		return ""
+	}
+	offset := d.pos
+	r := make([]byte, 0, d.capacity(l, 1))
+	for ; l > 0; l-- {
+		b := d.peek(field, 1)
+		if b == nil {
+			return ""
+		}
+		r = append(r, b[0])
+		d.consume(b)
+	}
+	if d.trace != nil {
+		d.trace(offset, r, d.msg, field, string(r))
+	}
+	return string(r)
+}
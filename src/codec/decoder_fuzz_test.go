@@ -0,0 +1,187 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	. "model"
+	"testing"
+)
+
+// gameStream encodes what a client reads during a short game.
+func gameStream(tb testing.TB) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+
+	me := &Player{Id: 1, Me: true}
+	f := &Facility{Id: 3, OwnerPlayerId: -1, Left: 32}
+	e.WriteTeamSizeMessage(1)
+	e.WriteGameContextMessage(&Game{TickCount: 2, WorldWidth: 64, WorldHeight: 64, MaxUnitGroup: 4,
+		TerrainWeatherMapColumnCount: 2, TerrainWeatherMapRowCount: 2, VehicleRadius: 2, FacilityWidth: 32, FacilityHeight: 32})
+	e.WritePlayerContextMessage(&PlayerContext{Player: me, World: &World{
+		Width: 64, Height: 64, Players: []*Player{me, {Id: 2}}, Facilities: []*Facility{f},
+		NewVehicles:     []*Vehicle{{CircularUnit: CircularUnit{Unit: Unit{Id: 1, X: 1, Y: 2}, Radius: 2}, PlayerId: 1, Groups: []int{1}}},
+		TerrainByCellXY: [][]Terrain{{Terrain_Plain, Terrain_Swamp}, {Terrain_Forest, Terrain_Plain}},
+		WeatherByCellXY: [][]Weather{{Weather_Clear, Weather_Rain}, {Weather_Cloud, Weather_Clear}},
+	}})
+	e.WritePlayerContextMessage(&PlayerContext{Player: me, World: &World{
+		TickIndex: 1, Players: []*Player{me, {Id: 2, Score: 1}}, Facilities: []*Facility{f},
+		VehicleUpdates: []*VehicleUpdate{{Id: 1, X: 2, Y: 2, Durability: 90, Groups: []int{1, 2}}},
+	}})
+	e.WriteGameOverMessage()
+	if err := e.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkErr fails unless err is nil, the end of the game or a
+// ProtocolError, the only errors the decoder reports.
+func checkErr(t *testing.T, err error) {
+	var pe *ProtocolError
+	if err != nil && err != ErrGameOver && !errors.As(err, &pe) {
+		t.Fatalf("unexpected error %T: %v", err, err)
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	stream := gameStream(f)
+	f.Add(stream)
+	f.Add(stream[:len(stream)/2])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// The client: team size and game, then contexts until an error.
+		for _, pooled := range []bool{false, true} {
+			d := NewDecoder(bytes.NewReader(data))
+			d.SetPooled(pooled)
+			if _, err := d.ReadTeamSizeMessage(); err != nil {
+				checkErr(t, err)
+				continue
+			}
+			if _, err := d.ReadGameContextMessage(); err != nil {
+				checkErr(t, err)
+				continue
+			}
+			pc := &PlayerContext{Player: new(Player), World: new(World)}
+			var err error
+			for err == nil {
+				err = d.ReadContextMessage(pc)
+			}
+			checkErr(t, err)
+		}
+
+		// Tools reading any message: every one consumes at least its opcode.
+		d := NewDecoder(bytes.NewReader(data))
+		var err error
+		for err == nil {
+			_, _, err = d.ReadMessage()
+		}
+		checkErr(t, err)
+	})
+}
+
+func TestTooLong(t *testing.T) {
+	// A length prefix far beyond the limit, with nothing behind it.
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.WriteOpcode(Message_AuthenticationToken)
+	e.writeInt("Token", 1<<30)
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDecoder(&buf).ReadTokenMessage(); !errors.Is(err, ErrTooLong) {
+		t.Errorf("oversized token: got %v, want ErrTooLong", err)
+	}
+
+	// A team size that would make the client create that many strategies.
+	e.WriteTeamSizeMessage(1 << 30)
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDecoder(&buf).ReadTeamSizeMessage(); !errors.Is(err, ErrTooLong) {
+		t.Errorf("oversized team: got %v, want ErrTooLong", err)
+	}
+
+	// A list longer than an explicit limit.
+	d := NewDecoder(bytes.NewReader(gameStream(t)))
+	d.SetLimits(Limits{MaxPlayers: 1})
+	d.ReadTeamSizeMessage()
+	d.ReadGameContextMessage()
+	err := d.ReadContextMessage(&PlayerContext{Player: new(Player), World: new(World)})
+	if !errors.Is(err, ErrTooLong) {
+		t.Errorf("two players with MaxPlayers 1: got %v, want ErrTooLong", err)
+	}
+}
+
+func TestOpcodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.WriteTeamSizeMessage(1)
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want error
+		text string
+	}{
+		{"empty", nil, io.EOF, "read opcode at offset 0: EOF"},
+		{"end", stream, io.EOF, "read TeamSize.opcode at offset 5: EOF"},
+		{"unknown", append(bytes.Clone(stream), 99), ErrWrongType,
+			"read TeamSize.opcode at offset 5: wrong message type: MessageType(99) is unknown in protocol version 3"},
+	} {
+		d := NewDecoder(bytes.NewReader(tc.data))
+		var err error
+		for err == nil {
+			_, _, err = d.ReadMessage()
+		}
+		if !errors.Is(err, tc.want) || err.Error() != tc.text {
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.text)
+		}
+	}
+
+	// Expecting a message names it even when the opcode is unknown.
+	err := NewDecoder(bytes.NewReader([]byte{99})).Expect(Message_GameContext)
+	if !errors.Is(err, ErrWrongType) || errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("unknown opcode for GameContext: got %v, want ErrWrongType", err)
+	}
+}
+
+func TestInvalidTeamSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		e.WriteTeamSizeMessage(size)
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		stream := buf.Bytes()
+
+		var pe *ProtocolError
+		if _, err := NewDecoder(bytes.NewReader(stream)).ReadTeamSizeMessage(); !errors.As(err, &pe) || pe.Field != "TeamSize" {
+			t.Errorf("team size %d: got %v, want a ProtocolError on TeamSize", size, err)
+		}
+		if _, _, err := NewDecoder(bytes.NewReader(stream)).ReadMessage(); !errors.As(err, &pe) {
+			t.Errorf("team size %d in ReadMessage: got %v, want a ProtocolError", size, err)
+		}
+	}
+}
+
+func TestLimitsFor(t *testing.T) {
+	l := LimitsFor(&Game{WorldWidth: 64, WorldHeight: 32, VehicleRadius: 2, FacilityWidth: 32, FacilityHeight: 32})
+	if l.MaxVehicles != 256 || l.MaxFacilities != 2 {
+		t.Errorf("64x32 world: %d vehicles and %d facilities, want 256 and 2", l.MaxVehicles, l.MaxFacilities)
+	}
+
+	// Without a world size nothing fits, which must not forbid every list.
+	l = LimitsFor(&Game{VehicleRadius: 2, FacilityWidth: 32, FacilityHeight: 32})
+	if d := DefaultLimits(); l.MaxVehicles != d.MaxVehicles || l.MaxFacilities != d.MaxFacilities {
+		t.Errorf("no world size: %d vehicles and %d facilities, want the defaults %d and %d",
+			l.MaxVehicles, l.MaxFacilities, d.MaxVehicles, d.MaxFacilities)
+	}
+}
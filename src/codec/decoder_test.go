@@ -0,0 +1,224 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	. "model"
+	"reflect"
+	"testing"
+)
+
+// tickStream encodes the game constants and the first tick of a game with
+// 1000 vehicles, then separately a later tick where every vehicle moves,
+// the payload decoded most often during a game.
+func tickStream(tb testing.TB) (start, tick []byte) {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+
+	g := &Game{
+		TickCount: 20000, WorldWidth: 1024, WorldHeight: 1024, MaxUnitGroup: 100, VehicleRadius: 2,
+		TerrainWeatherMapColumnCount: 32, TerrainWeatherMapRowCount: 32, FacilityWidth: 64, FacilityHeight: 64,
+	}
+	players := []*Player{{Id: 1, Me: true}, {Id: 2}}
+	facilities := make([]*Facility, 16)
+	for i := range facilities {
+		facilities[i] = &Facility{Id: int64(i + 1), OwnerPlayerId: -1, Left: float64(i%4) * 256, Top: float64(i/4) * 256}
+	}
+
+	w := &World{
+		Width: 1024, Height: 1024, Players: players, Facilities: facilities,
+		TerrainByCellXY: make([][]Terrain, 32), WeatherByCellXY: make([][]Weather, 32),
+	}
+	for i := range w.TerrainByCellXY {
+		w.TerrainByCellXY[i] = make([]Terrain, 32)
+		w.WeatherByCellXY[i] = make([]Weather, 32)
+	}
+	for i := 0; i < 1000; i++ {
+		w.NewVehicles = append(w.NewVehicles, &Vehicle{
+			CircularUnit: CircularUnit{Unit: Unit{Id: int64(i + 1), X: float64(i % 100), Y: float64(i / 100)}, Radius: 2},
+			PlayerId:     int64(1 + i/500),
+			Durability:   100, MaxDurability: 100, MaxSpeed: 0.4,
+			Groups: []int{1 + i%3},
+		})
+	}
+	e.WriteGameContextMessage(g)
+	e.WritePlayerContextMessage(&PlayerContext{Player: players[0], World: w})
+	if err := e.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	start = bytes.Clone(buf.Bytes())
+	buf.Reset()
+
+	w = &World{TickIndex: 1, Players: players, Facilities: facilities}
+	for i := 0; i < 1000; i++ {
+		w.VehicleUpdates = append(w.VehicleUpdates, &VehicleUpdate{
+			Id: int64(i + 1), X: float64(i%100) + 0.4, Y: float64(i / 100), Durability: 100,
+			Groups: []int{1 + i%3},
+		})
+	}
+	e.WritePlayerContextMessage(&PlayerContext{Player: players[0], World: w})
+	if err := e.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	return start, bytes.Clone(buf.Bytes())
+}
+
+// BenchmarkDecodeTick decodes the context of one tick with 1000 vehicle
+// updates, after the decoder has seen the start of the game, with the
+// binary.Read reference and with the decoder with and without pooling.
+func BenchmarkDecodeTick(b *testing.B) {
+	start, tick := tickStream(b)
+
+	b.Run("binary.Read", func(b *testing.B) {
+		r := bytes.NewReader(start)
+		br := bufio.NewReader(r)
+		c := legacyAfterGame(b, start, r, br)
+		pc := &PlayerContext{Player: new(Player), World: new(World)}
+		if err := c.readContext(pc); err != nil {
+			b.Fatal(err)
+		}
+
+		b.ReportAllocs()
+		b.SetBytes(int64(len(tick)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			r.Reset(tick)
+			br.Reset(r)
+			if err := c.readContext(pc); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, mode := range []struct {
+		name   string
+		pooled bool
+	}{{"default", false}, {"pooled", true}} {
+		b.Run(mode.name, func(b *testing.B) {
+			r := bytes.NewReader(start)
+			d := NewDecoder(r)
+			d.SetPooled(mode.pooled)
+			pc := &PlayerContext{Player: new(Player), World: new(World)}
+			if _, err := d.ReadGameContextMessage(); err != nil {
+				b.Fatal(err)
+			}
+			if err := d.ReadContextMessage(pc); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(tick)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.Reset(tick)
+				d.Reset(r)
+				if err := d.ReadContextMessage(pc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// legacyAfterGame returns a legacyDecoder reading start through br from r,
+// past the game constants, which it does not decode.
+func legacyAfterGame(tb testing.TB, start []byte, r *bytes.Reader, br *bufio.Reader) *legacyDecoder {
+	tb.Helper()
+	d := NewDecoder(bytes.NewReader(start))
+	if _, err := d.ReadGameContextMessage(); err != nil {
+		tb.Fatal(err)
+	}
+	r.Reset(start[d.Offset():])
+	br.Reset(r)
+	return newLegacyDecoder(br)
+}
+
+// TestDecoderMatchesLegacy checks that both sides of BenchmarkDecodeTick
+// decode the same worlds.
+func TestDecoderMatchesLegacy(t *testing.T) {
+	start, tick := tickStream(t)
+
+	r := bytes.NewReader(start)
+	br := bufio.NewReader(r)
+	c := legacyAfterGame(t, start, r, br)
+	d := NewDecoder(bytes.NewReader(append(bytes.Clone(start), tick...)))
+	if _, err := d.ReadGameContextMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		want := &PlayerContext{Player: new(Player), World: new(World)}
+		got := &PlayerContext{Player: new(Player), World: new(World)}
+		if i == 1 {
+			r.Reset(tick)
+			br.Reset(r)
+		}
+		if err := c.readContext(want); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.ReadContextMessage(got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("message %d: decoded %+v\nbinary.Read %+v", i, *got.World, *want.World)
+		}
+	}
+}
+
+// TestPooledMatchesDefault decodes ticks whose update lists and groups
+// grow, shrink and empty, so that pooled decoding has to both reuse and
+// extend what the previous tick left, and compares every World with the
+// one decoded without pooling.
+func TestPooledMatchesDefault(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	me := &Player{Id: 1, Me: true}
+	e.WriteGameContextMessage(&Game{TickCount: 10, MaxUnitGroup: 10})
+	for tick := 0; tick < 10; tick++ {
+		w := &World{TickIndex: tick, Players: []*Player{me}}
+		for i := 0; i < []int{5, 3, 8, 0, 8, 1, 6, 6, 2, 7}[tick]; i++ {
+			w.VehicleUpdates = append(w.VehicleUpdates, &VehicleUpdate{
+				Id: int64(i + 1), X: float64(tick), Y: float64(i), Durability: 100 - tick,
+				Groups: []int{1, 2, 3, 4}[:(tick+i)%5],
+			})
+		}
+		e.WritePlayerContextMessage(&PlayerContext{Player: me, World: w})
+	}
+	e.WriteGameOverMessage()
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := buf.Bytes()
+	plain, pooled := NewDecoder(bytes.NewReader(stream)), NewDecoder(bytes.NewReader(stream))
+	pooled.SetPooled(true)
+	for _, d := range []*Decoder{plain, pooled} {
+		if _, err := d.ReadGameContextMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := &PlayerContext{Player: new(Player), World: new(World)}
+	got := &PlayerContext{Player: new(Player), World: new(World)}
+	for tick := 0; ; tick++ {
+		errWant, errGot := plain.ReadContextMessage(want), pooled.ReadContextMessage(got)
+		if errWant != errGot {
+			t.Fatalf("tick %d: pooled error %v, default %v", tick, errGot, errWant)
+		}
+		if errWant == ErrGameOver {
+			break
+		} else if errWant != nil {
+			t.Fatal(errWant)
+		}
+		if !reflect.DeepEqual(got.World, want.World) {
+			for i, v := range got.World.VehicleUpdates {
+				if i < len(want.World.VehicleUpdates) && !reflect.DeepEqual(v, want.World.VehicleUpdates[i]) {
+					t.Errorf("tick %d, update %d: pooled %#v, default %#v", tick, i, *v, *want.World.VehicleUpdates[i])
+				}
+			}
+			t.Errorf("tick %d: pooled %+v\ndefault %+v", tick, *got.World, *want.World)
+		}
+	}
+}
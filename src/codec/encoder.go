@@ -0,0 +1,409 @@
+package codec
+
+import (
+	"bufio"
+	"io"
+	"math"
+	. "model"
+)
+
+// Encoder writes protocol messages. Messages are buffered until Flush.
+// Like the Decoder, it keeps the first error and ignores later writes.
+type Encoder struct {
+	writer *bufio.Writer
+	tap    io.Writer
+	trace  Trace
+
+	players    map[int64]Player
+	facilities map[int64]Facility
+
+	version int
+	game    Schema[Game]
+	world   Schema[World]
+
+	err     error
+	msg     MessageType
+	pos     int64
+	scratch [8]byte
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	e := &Encoder{
+		writer:     bufio.NewWriter(w),
+		players:    make(map[int64]Player),
+		facilities: make(map[int64]Facility),
+	}
+	e.SetVersion(Version)
+	return e
+}
+
+// SetVersion selects the message layouts of protocol version v.
+func (e *Encoder) SetVersion(v int) error {
+	if !Supported(v) {
+		return versionError(v)
+	}
+	e.version, e.game, e.world = v, GameSchema.For(v), WorldSchema.For(v)
+	return nil
+}
+
+func (e *Encoder) Version() int {
+	return e.version
+}
+
+// SetTap makes the encoder copy every written byte to w.
+func (e *Encoder) SetTap(w io.Writer) {
+	e.tap = w
+}
+
+// SetTrace makes the encoder report every field it writes to t.
+func (e *Encoder) SetTrace(t Trace) {
+	e.trace = t
+}
+
+func (e *Encoder) Err() error {
+	return e.err
+}
+
+// Offset returns the number of bytes written so far.
+func (e *Encoder) Offset() int64 {
+	return e.pos
+}
+
+func (e *Encoder) Flush() error {
+	if e.err != nil {
+		return e.err
+	}
+	if err := e.writer.Flush(); err != nil {
+		e.fail("", err)
+	}
+	return e.err
+}
+
+func (e *Encoder) fail(field string, err error) {
+	if e.err == nil {
+		e.err = &ProtocolError{Op: "write", Message: e.msg, Field: field, Offset: e.pos, Err: err}
+	}
+}
+
+func (e *Encoder) WriteGameContextMessage(g *Game) error {
+	e.WriteOpcode(Message_GameContext)
+	e.WriteGame(g)
+	return e.err
+}
+
+func (e *Encoder) WriteGame(g *Game) {
+	e.writeBool("Game", g != nil)
+	if g != nil {
+		writeFields(e, e.game, g)
+	}
+}
+
+func (e *Encoder) WritePlayerContextMessage(pc *PlayerContext) error {
+	e.WriteOpcode(Message_PlayerContext)
+	e.WritePlayerContext(pc)
+	return e.err
+}
+
+func (e *Encoder) WritePlayerContext(pc *PlayerContext) {
+	e.writeBool("PlayerContext", pc != nil)
+	if pc == nil {
+		return
+	}
+
+	e.WritePlayer(pc.Player)
+	e.WriteWorld(pc.World)
+}
+
+// WritePlayer sends only the Id of a player that has not changed since it
+// was last written by this encoder.
+func (e *Encoder) WritePlayer(p *Player) {
+	if p == nil {
+		e.writeByte("Player", recordNone)
+		return
+	}
+
+	if prev, ok := e.players[p.Id]; ok && prev == *p {
+		e.writeByte("Player", recordCached)
+		e.writeInt64("Player.Id", p.Id)
+		return
+	}
+	e.players[p.Id] = *p
+
+	e.writeByte("Player", recordFull)
+	e.writeInt64("Player.Id", p.Id)
+	e.writeBool("Player.Me", p.Me)
+	e.writeBool("Player.StrategyCrashed", p.StrategyCrashed)
+	e.writeInt("Player.Score", p.Score)
+	e.writeInt("Player.RemainingActionCooldownTicks", p.RemainingActionCooldownTicks)
+	e.writeInt("Player.RemainingNuclearStrikeCooldownTicks", p.RemainingNuclearStrikeCooldownTicks)
+	e.writeInt64("Player.NextNuclearStrikeVehicleId", p.NextNuclearStrikeVehicleId)
+	e.writeInt("Player.NextNuclearStrikeTickIndex", p.NextNuclearStrikeTickIndex)
+	e.writeFloat64("Player.NextNuclearStrikeX", p.NextNuclearStrikeX)
+	e.writeFloat64("Player.NextNuclearStrikeY", p.NextNuclearStrikeY)
+}
+
+func (e *Encoder) WriteWorld(w *World) {
+	e.writeBool("World", w != nil)
+	if w != nil {
+		writeFields(e, e.world, w)
+	}
+}
+
+func (e *Encoder) writePlayers(players []*Player) {
+	e.writeInt("World.Players", len(players))
+	for _, p := range players {
+		e.WritePlayer(p)
+	}
+}
+
+func (e *Encoder) writeVehicles(vehicles []*Vehicle) {
+	e.writeInt("World.NewVehicles", len(vehicles))
+	for _, v := range vehicles {
+		e.WriteVehicle(v)
+	}
+}
+
+func (e *Encoder) writeVehicleUpdates(updates []*VehicleUpdate) {
+	e.writeInt("World.VehicleUpdates", len(updates))
+	for _, v := range updates {
+		e.WriteVehicleUpdate(v)
+	}
+}
+
+func (e *Encoder) writeTerrains(terrain [][]Terrain) {
+	e.writeInt("World.TerrainByCellXY", len(terrain))
+	for _, col := range terrain {
+		e.writeInt("World.TerrainByCellXY", len(col))
+		for _, t := range col {
+			e.writeByte("World.TerrainByCellXY", byte(t))
+		}
+	}
+}
+
+func (e *Encoder) writeWeather(weather [][]Weather) {
+	e.writeInt("World.WeatherByCellXY", len(weather))
+	for _, col := range weather {
+		e.writeInt("World.WeatherByCellXY", len(col))
+		for _, t := range col {
+			e.writeByte("World.WeatherByCellXY", byte(t))
+		}
+	}
+}
+
+func (e *Encoder) writeFacilities(facilities []*Facility) {
+	e.writeInt("World.Facilities", len(facilities))
+	for _, f := range facilities {
+		e.WriteFacility(f)
+	}
+}
+
+func (e *Encoder) WriteVehicle(v *Vehicle) {
+	e.writeBool("Vehicle", v != nil)
+	if v == nil {
+		return
+	}
+
+	e.writeInt64("Vehicle.Id", v.Id)
+	e.writeFloat64("Vehicle.X", v.X)
+	e.writeFloat64("Vehicle.Y", v.Y)
+	e.writeFloat64("Vehicle.Radius", v.Radius)
+	e.writeInt64("Vehicle.PlayerId", v.PlayerId)
+	e.writeInt("Vehicle.Durability", v.Durability)
+	e.writeInt("Vehicle.MaxDurability", v.MaxDurability)
+	e.writeFloat64("Vehicle.MaxSpeed", v.MaxSpeed)
+	e.writeFloat64("Vehicle.VisionRange", v.VisionRange)
+	e.writeFloat64("Vehicle.SquaredVisionRange", v.SquaredVisionRange)
+	e.writeFloat64("Vehicle.GroundAttackRange", v.GroundAttackRange)
+	e.writeFloat64("Vehicle.SquaredGroundAttackRange", v.SquaredGroundAttackRange)
+	e.writeFloat64("Vehicle.AerialAttackRange", v.AerialAttackRange)
+	e.writeFloat64("Vehicle.SquaredAerialAttackRange", v.SquaredAerialAttackRange)
+	e.writeInt("Vehicle.GroundDamage", v.GroundDamage)
+	e.writeInt("Vehicle.AerialDamage", v.AerialDamage)
+	e.writeInt("Vehicle.GroundDefence", v.GroundDefence)
+	e.writeInt("Vehicle.AerialDefence", v.AerialDefence)
+	e.writeInt("Vehicle.AttackCooldownTicks", v.AttackCooldownTicks)
+	e.writeInt("Vehicle.RemainingAttackCooldownTicks", v.RemainingAttackCooldownTicks)
+	e.writeByte("Vehicle.Type", byte(v.Type))
+	e.writeBool("Vehicle.Aerial", v.Aerial)
+	e.writeBool("Vehicle.Selected", v.Selected)
+	e.writeIntArray("Vehicle.Groups", v.Groups)
+}
+
+func (e *Encoder) WriteVehicleUpdate(v *VehicleUpdate) {
+	e.writeBool("VehicleUpdate", v != nil)
+	if v == nil {
+		return
+	}
+
+	e.writeInt64("VehicleUpdate.Id", v.Id)
+	e.writeFloat64("VehicleUpdate.X", v.X)
+	e.writeFloat64("VehicleUpdate.Y", v.Y)
+	e.writeInt("VehicleUpdate.Durability", v.Durability)
+	e.writeInt("VehicleUpdate.RemainingAttackCooldownTicks", v.RemainingAttackCooldownTicks)
+	e.writeBool("VehicleUpdate.Selected", v.Selected)
+	e.writeIntArray("VehicleUpdate.Groups", v.Groups)
+}
+
+// WriteFacility sends only the Id of a facility that has not changed since
+// it was last written by this encoder.
+func (e *Encoder) WriteFacility(f *Facility) {
+	if f == nil {
+		e.writeByte("Facility", recordNone)
+		return
+	}
+
+	if prev, ok := e.facilities[f.Id]; ok && prev == *f {
+		e.writeByte("Facility", recordCached)
+		e.writeInt64("Facility.Id", f.Id)
+		return
+	}
+	e.facilities[f.Id] = *f
+
+	e.writeByte("Facility", recordFull)
+	e.writeInt64("Facility.Id", f.Id)
+	e.writeByte("Facility.FacilityType", byte(f.FacilityType))
+	e.writeInt64("Facility.OwnerPlayerId", f.OwnerPlayerId)
+	e.writeFloat64("Facility.Left", f.Left)
+	e.writeFloat64("Facility.Top", f.Top)
+	e.writeFloat64("Facility.CapturePoints", f.CapturePoints)
+	e.writeByte("Facility.VehicleType", byte(f.VehicleType))
+	e.writeInt("Facility.ProductionProgress", f.ProductionProgress)
+}
+
+func (e *Encoder) WriteMoveMessage(m *Move) error {
+	e.WriteOpcode(Message_Move)
+	e.WriteMove(m)
+	return e.err
+}
+
+func (e *Encoder) WriteMove(m *Move) {
+	if m == nil {
+		e.writeBool("Move", false)
+		return
+	}
+
+	e.writeBool("Move", true)
+	e.writeByte("Action", byte(m.Action))
+	e.writeInt("Group", m.Group)
+	e.writeFloat64("Left", m.Left)
+	e.writeFloat64("Top", m.Top)
+	e.writeFloat64("Right", m.Right)
+	e.writeFloat64("Bottom", m.Bottom)
+	e.writeFloat64("X", m.X)
+	e.writeFloat64("Y", m.Y)
+	e.writeFloat64("Angle", m.Angle)
+	e.writeFloat64("Factor", m.Factor)
+	e.writeFloat64("MaxSpeed", m.MaxSpeed)
+	e.writeFloat64("MaxAngularSpeed", m.MaxAngularSpeed)
+	e.writeByte("Type", byte(m.Type))
+	e.writeInt64("FacilityId", m.FacilityId)
+	e.writeInt64("VehicleId", m.VehicleId)
+}
+
+func (e *Encoder) WriteTokenMessage(token string) error {
+	e.WriteOpcode(Message_AuthenticationToken)
+	e.writeString("Token", token)
+	return e.err
+}
+
+func (e *Encoder) WriteProtocolVersionMessage(ver int) error {
+	e.WriteOpcode(Message_ProtocolVersion)
+	e.writeInt("Version", ver)
+	return e.err
+}
+
+func (e *Encoder) WriteTeamSizeMessage(size int) error {
+	e.WriteOpcode(Message_TeamSize)
+	e.writeInt("TeamSize", size)
+	return e.err
+}
+
+func (e *Encoder) WriteGameOverMessage() error {
+	e.WriteOpcode(Message_GameOver)
+	return e.err
+}
+
+func (e *Encoder) WriteOpcode(m MessageType) {
+	e.msg = m
+	e.scratch[0] = byte(m)
+	if e.trace != nil {
+		e.trace(e.pos, e.scratch[:1], m, "opcode", m)
+	}
+	e.write("opcode", e.scratch[:1])
+}
+
+func (e *Encoder) writeIntArray(field string, arr []int) {
+	e.writeInt(field, len(arr))
+	for _, v := range arr {
+		e.writeInt(field, v)
+	}
+}
+
+func (e *Encoder) write(field string, b []byte) {
+	if e.err != nil {
+		return
+	}
+	if _, err := e.writer.Write(b); err != nil {
+		e.fail(field, err)
+		return
+	}
+	if e.tap != nil {
+		e.tap.Write(b)
+	}
+	e.pos += int64(len(b))
+}
+
+// The primitives below check e.trace before calling it so that values are
+// not boxed when tracing is off.
+
+func (e *Encoder) writeByte(field string, v byte) {
+	e.scratch[0] = v
+	if e.trace != nil {
+		e.trace(e.pos, e.scratch[:1], e.msg, field, v)
+	}
+	e.write(field, e.scratch[:1])
+}
+
+func (e *Encoder) writeBool(field string, v bool) {
+	e.scratch[0] = 0
+	if v {
+		e.scratch[0] = 1
+	}
+	if e.trace != nil {
+		e.trace(e.pos, e.scratch[:1], e.msg, field, v)
+	}
+	e.write(field, e.scratch[:1])
+}
+
+func (e *Encoder) writeInt(field string, v int) {
+	ByteOrder.PutUint32(e.scratch[:4], uint32(int32(v)))
+	if e.trace != nil {
+		e.trace(e.pos, e.scratch[:4], e.msg, field, v)
+	}
+	e.write(field, e.scratch[:4])
+}
+
+func (e *Encoder) writeInt64(field string, v int64) {
+	ByteOrder.PutUint64(e.scratch[:], uint64(v))
+	if e.trace != nil {
+		e.trace(e.pos, e.scratch[:], e.msg, field, v)
+	}
+	e.write(field, e.scratch[:])
+}
+
+func (e *Encoder) writeFloat64(field string, v float64) {
+	ByteOrder.PutUint64(e.scratch[:], math.Float64bits(v))
+	if e.trace != nil {
+		e.trace(e.pos, e.scratch[:], e.msg, field, v)
+	}
+	e.write(field, e.scratch[:])
+}
+
+func (e *Encoder) writeString(field string, v string) {
+	e.writeInt(field, len(v))
+	b := []byte(v)
+	if e.trace != nil {
+		e.trace(e.pos, b, e.msg, field, v)
+	}
+	e.write(field, b)
+}
@@ -0,0 +1,270 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	. "model"
+)
+
+// legacyDecoder reads player contexts the way the client did before this
+// package existed, with binary.Read for every number and a panic on any
+// error. BenchmarkDecodeTick measures the decoder against it.
+type legacyDecoder struct {
+	reader *bufio.Reader
+
+	players    map[int64]*Player
+	facilities map[int64]*Facility
+}
+
+func newLegacyDecoder(r *bufio.Reader) *legacyDecoder {
+	return &legacyDecoder{reader: r, players: make(map[int64]*Player), facilities: make(map[int64]*Facility)}
+}
+
+func (c *legacyDecoder) readContext(pc *PlayerContext) error {
+	switch MessageType(c.readByte()) {
+	case Message_GameOver:
+		return ErrGameOver
+	case Message_PlayerContext:
+		if c.readBool() {
+			if me := c.readPlayer(); me != nil {
+				*pc.Player = *me
+			}
+			c.readWorld(pc.World)
+		}
+		return nil
+	default:
+		return ErrWrongType
+	}
+}
+
+func (c *legacyDecoder) readPlayer() *Player {
+	switch c.readByte() {
+	case 0:
+		return nil
+	case 127:
+		return c.players[c.readInt64()]
+	default:
+		p := new(Player)
+		p.Id = c.readInt64()
+		p.Me = c.readBool()
+		p.StrategyCrashed = c.readBool()
+		p.Score = c.readInt()
+		p.RemainingActionCooldownTicks = c.readInt()
+		p.RemainingNuclearStrikeCooldownTicks = c.readInt()
+		p.NextNuclearStrikeVehicleId = c.readInt64()
+		p.NextNuclearStrikeTickIndex = c.readInt()
+		p.NextNuclearStrikeX = c.readFloat64()
+		p.NextNuclearStrikeY = c.readFloat64()
+
+		c.players[p.Id] = p
+
+		return p
+	}
+}
+
+func (c *legacyDecoder) readWorld(w *World) {
+	if c.readBool() {
+		w.TickIndex = c.readInt()
+		w.TickCount = c.readInt()
+		w.Width = c.readFloat64()
+		w.Height = c.readFloat64()
+		w.Players = c.readPlayers()
+		w.NewVehicles = c.readVehicles()
+		w.VehicleUpdates = c.readVehiclesUpdate()
+
+		if w.TickIndex == 0 {
+			w.TerrainByCellXY = c.readTerrains()
+			w.WeatherByCellXY = c.readWeather()
+		}
+
+		w.Facilities = c.readFacilities()
+	}
+}
+
+func (c *legacyDecoder) readWeather() (weather [][]Weather) {
+	for i := c.readInt(); i > 0; i-- {
+		var slice []Weather
+		for j := c.readInt(); j > 0; j-- {
+			slice = append(slice, Weather(c.readByte()))
+		}
+		weather = append(weather, slice)
+	}
+	return
+}
+
+func (c *legacyDecoder) readTerrains() (terrain [][]Terrain) {
+	for i := c.readInt(); i > 0; i-- {
+		var slice []Terrain
+		for j := c.readInt(); j > 0; j-- {
+			slice = append(slice, Terrain(c.readByte()))
+		}
+		terrain = append(terrain, slice)
+	}
+	return
+}
+
+func (c *legacyDecoder) readFacility() *Facility {
+	switch c.readByte() {
+	case 0:
+		return nil
+	case 127:
+		return c.facilities[c.readInt64()]
+	default:
+		f := new(Facility)
+		f.Id = c.readInt64()
+		f.FacilityType = FacilityType(c.readByte())
+		f.OwnerPlayerId = c.readInt64()
+		f.Left = c.readFloat64()
+		f.Top = c.readFloat64()
+		f.CapturePoints = c.readFloat64()
+		f.VehicleType = VehicleType(c.readByte())
+		f.ProductionProgress = c.readInt()
+
+		c.facilities[f.Id] = f
+
+		return f
+	}
+}
+
+func (c *legacyDecoder) readVehicleUpdate() *VehicleUpdate {
+	if c.readBool() {
+		v := new(VehicleUpdate)
+		v.Id = c.readInt64()
+		v.X = c.readFloat64()
+		v.Y = c.readFloat64()
+		v.Durability = c.readInt()
+		v.RemainingAttackCooldownTicks = c.readInt()
+		v.Selected = c.readBool()
+		v.Groups = c.readIntArray()
+
+		return v
+	}
+	return nil
+}
+
+func (c *legacyDecoder) readNewVehicle() *Vehicle {
+	if c.readBool() {
+		v := new(Vehicle)
+		v.Id = c.readInt64()
+		v.X = c.readFloat64()
+		v.Y = c.readFloat64()
+		v.Radius = c.readFloat64()
+		v.PlayerId = c.readInt64()
+		v.Durability = c.readInt()
+		v.MaxDurability = c.readInt()
+		v.MaxSpeed = c.readFloat64()
+		v.VisionRange = c.readFloat64()
+		v.SquaredVisionRange = c.readFloat64()
+		v.GroundAttackRange = c.readFloat64()
+		v.SquaredGroundAttackRange = c.readFloat64()
+		v.AerialAttackRange = c.readFloat64()
+		v.SquaredAerialAttackRange = c.readFloat64()
+		v.GroundDamage = c.readInt()
+		v.AerialDamage = c.readInt()
+		v.GroundDefence = c.readInt()
+		v.AerialDefence = c.readInt()
+		v.AttackCooldownTicks = c.readInt()
+		v.RemainingAttackCooldownTicks = c.readInt()
+		v.Type = VehicleType(c.readByte())
+		v.Aerial = c.readBool()
+		v.Selected = c.readBool()
+		v.Groups = c.readIntArray()
+
+		return v
+	}
+	return nil
+}
+
+func (c *legacyDecoder) readVehiclesUpdate() (updates []*VehicleUpdate) {
+	for l := c.readInt(); l > 0; l-- {
+		if v := c.readVehicleUpdate(); v != nil {
+			updates = append(updates, v)
+		}
+	}
+	return
+}
+
+func (c *legacyDecoder) readFacilities() (facilities []*Facility) {
+	if l := c.readInt(); l > 0 {
+		for ; l > 0; l-- {
+			if f := c.readFacility(); f != nil {
+				facilities = append(facilities, f)
+			}
+		}
+	} else {
+		for _, f := range c.facilities {
+			facilities = append(facilities, f)
+		}
+	}
+	return
+}
+
+func (c *legacyDecoder) readVehicles() (vehicles []*Vehicle) {
+	for l := c.readInt(); l > 0; l-- {
+		if v := c.readNewVehicle(); v != nil {
+			vehicles = append(vehicles, v)
+		}
+	}
+	return
+}
+
+func (c *legacyDecoder) readPlayers() (players []*Player) {
+	if l := c.readInt(); l > 0 {
+		for ; l > 0; l-- {
+			if p := c.readPlayer(); p != nil {
+				players = append(players, p)
+			}
+		}
+	} else {
+		for _, p := range c.players {
+			players = append(players, p)
+		}
+	}
+	return
+}
+
+func (c *legacyDecoder) readIntArray() []int {
+	var arr []int
+	if ln := c.readInt(); ln > 0 {
+		for ; ln > 0; ln-- {
+			arr = append(arr, c.readInt())
+		}
+	}
+	return arr
+}
+
+func (c *legacyDecoder) readInt() int {
+	var v int32
+	if err := binary.Read(c.reader, ByteOrder, &v); err != nil {
+		panic(err)
+	}
+	return int(v)
+}
+
+func (c *legacyDecoder) readInt64() int64 {
+	var v int64
+	if err := binary.Read(c.reader, ByteOrder, &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (c *legacyDecoder) readFloat64() float64 {
+	var v float64
+	if err := binary.Read(c.reader, ByteOrder, &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (c *legacyDecoder) readBool() bool {
+	return c.readByte() != 0
+}
+
+func (c *legacyDecoder) readByte() byte {
+	b, err := c.reader.ReadByte()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,101 @@
+package codec
+
+import (
+	"errors"
+	"math"
+	. "model"
+)
+
+var ErrTooLong = errors.New("length exceeds limit")
+
+// Limits bounds the lengths the Decoder accepts for variable-length fields,
+// so that a corrupt or hostile stream fails with ErrTooLong instead of
+// exhausting memory. A zero field means no explicit limit.
+type Limits struct {
+	// MaxCells bounds both dimensions of the terrain and weather maps.
+	MaxCells int
+	// MaxVehicles bounds the NewVehicles and VehicleUpdates lists.
+	MaxVehicles   int
+	MaxGroups     int
+	MaxPlayers    int
+	MaxFacilities int
+	MaxString     int
+	// MaxTeamSize bounds the number of players one client controls.
+	MaxTeamSize int
+}
+
+// DefaultLimits returns the limits in force before the Game is known. They
+// also cap the limits derived from the Game.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxCells:      1 << 10,
+		MaxVehicles:   1 << 17,
+		MaxGroups:     1 << 10,
+		MaxPlayers:    1 << 4,
+		MaxFacilities: 1 << 12,
+		MaxString:     1 << 16,
+		MaxTeamSize:   1 << 4,
+	}
+}
+
+// LimitsFor derives limits from the game constants: the map size for
+// cells, MaxUnitGroup for groups, and the number of vehicles and facilities
+// that fit on the map without overlapping (twice for vehicles, as aerial
+// and ground ones may share a spot).
+func LimitsFor(g *Game) Limits {
+	l := DefaultLimits()
+	if g == nil {
+		return l
+	}
+
+	if n := max(g.TerrainWeatherMapColumnCount, g.TerrainWeatherMapRowCount); n > 0 {
+		l.MaxCells = min(l.MaxCells, n)
+	}
+	if g.MaxUnitGroup > 0 {
+		l.MaxGroups = min(l.MaxGroups, g.MaxUnitGroup)
+	}
+	if d := 2 * g.VehicleRadius; d > 0 {
+		l.MaxVehicles = min(l.MaxVehicles, fit(2*g.WorldWidth*g.WorldHeight, d*d))
+	}
+	if a := g.FacilityWidth * g.FacilityHeight; a > 0 {
+		l.MaxFacilities = min(l.MaxFacilities, fit(g.WorldWidth*g.WorldHeight, a))
+	}
+
+	return l
+}
+
+// fit returns how many items of the given area fit into total, rounded up.
+// Without a usable result, such as for an unset world size, it returns
+// math.MaxInt32 so that the default limit applies.
+func fit(total, area float64) int {
+	if n := math.Ceil(total / area); n >= 1 && n < math.MaxInt32 {
+		return int(n)
+	}
+	return math.MaxInt32
+}
+
+// Or returns l with every unset field taken from o.
+func (l Limits) Or(o Limits) Limits {
+	if l.MaxCells <= 0 {
+		l.MaxCells = o.MaxCells
+	}
+	if l.MaxVehicles <= 0 {
+		l.MaxVehicles = o.MaxVehicles
+	}
+	if l.MaxGroups <= 0 {
+		l.MaxGroups = o.MaxGroups
+	}
+	if l.MaxPlayers <= 0 {
+		l.MaxPlayers = o.MaxPlayers
+	}
+	if l.MaxFacilities <= 0 {
+		l.MaxFacilities = o.MaxFacilities
+	}
+	if l.MaxString <= 0 {
+		l.MaxString = o.MaxString
+	}
+	if l.MaxTeamSize <= 0 {
+		l.MaxTeamSize = o.MaxTeamSize
+	}
+	return l
+}
@@ -0,0 +1,267 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	. "model"
+)
+
+// MinVersion and Version bound the protocol versions the codec has
+// schemas for; Version is the one used unless another is negotiated.
+const MinVersion int = 3
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	// ErrVersionMismatch reports data that cannot have been sent in the
+	// layout of the negotiated version, typically a field read from the
+	// wrong offset because the server uses a different revision.
+	ErrVersionMismatch = errors.New("message layout does not match protocol version")
+)
+
+// Supported reports whether the codec has schemas for protocol version v.
+func Supported(v int) bool {
+	return v >= MinVersion && v <= Version
+}
+
+func versionError(v int) error {
+	return fmt.Errorf("%w %d (supported: %d to %d)", ErrUnsupportedVersion, v, MinVersion, Version)
+}
+
+// Schema lists the fields of a message body in wire order, across all
+// supported protocol versions. Supporting a new server revision means
+// adding its fields here with the right Since and Until.
+type Schema[T any] []Field[T]
+
+// Field describes one field of a message body.
+type Field[T any] struct {
+	Name string
+	// Since and Until bound the protocol versions carrying the field,
+	// inclusive; zero leaves the bound open.
+	Since, Until int
+	// Ref returns a pointer to the field in v. The pointer type decides the
+	// wire type: *bool, *int (int32), *int64, *float64 or one of the lists
+	// of the World.
+	Ref func(v *T) any
+	// When, if set, tells whether the field is sent in this message. It may
+	// look at the fields preceding it.
+	When func(v *T) bool
+	// Valid, if set, rejects values no server would send, which means the
+	// stream does not have the layout of the negotiated version.
+	Valid func(v *T) bool
+}
+
+// In reports whether the field is present in protocol version v.
+func (f *Field[T]) In(v int) bool {
+	return (f.Since == 0 || v >= f.Since) && (f.Until == 0 || v <= f.Until)
+}
+
+// For returns the fields present in protocol version v.
+func (s Schema[T]) For(v int) Schema[T] {
+	var r Schema[T]
+	for _, f := range s {
+		if f.In(v) {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// extent accepts sizes: non-negative and finite.
+func extent(x float64) bool {
+	return x >= 0 && !math.IsInf(x, 1)
+}
+
+var GameSchema = Schema[Game]{
+	{Name: "RandomSeed", Ref: func(g *Game) any { return &g.RandomSeed }},
+	{Name: "TickCount", Ref: func(g *Game) any { return &g.TickCount }, Valid: func(g *Game) bool { return g.TickCount >= 0 }},
+	{Name: "WorldWidth", Ref: func(g *Game) any { return &g.WorldWidth }, Valid: func(g *Game) bool { return extent(g.WorldWidth) }},
+	{Name: "WorldHeight", Ref: func(g *Game) any { return &g.WorldHeight }, Valid: func(g *Game) bool { return extent(g.WorldHeight) }},
+	{Name: "FogOfWarEnabled", Ref: func(g *Game) any { return &g.FogOfWarEnabled }},
+	{Name: "VictoryScore", Ref: func(g *Game) any { return &g.VictoryScore }},
+	{Name: "FacilityCaptureScore", Ref: func(g *Game) any { return &g.FacilityCaptureScore }},
+	{Name: "VehicleEliminationScore", Ref: func(g *Game) any { return &g.VehicleEliminationScore }},
+	{Name: "ActionDetectionInterval", Ref: func(g *Game) any { return &g.ActionDetectionInterval }},
+	{Name: "BaseActionCount", Ref: func(g *Game) any { return &g.BaseActionCount }},
+	{Name: "AdditionalActionCountPerControlCenter", Ref: func(g *Game) any { return &g.AdditionalActionCountPerControlCenter }},
+	{Name: "MaxUnitGroup", Ref: func(g *Game) any { return &g.MaxUnitGroup }, Valid: func(g *Game) bool { return g.MaxUnitGroup >= 0 }},
+	{Name: "TerrainWeatherMapColumnCount", Ref: func(g *Game) any { return &g.TerrainWeatherMapColumnCount }, Valid: func(g *Game) bool { return g.TerrainWeatherMapColumnCount >= 0 }},
+	{Name: "TerrainWeatherMapRowCount", Ref: func(g *Game) any { return &g.TerrainWeatherMapRowCount }, Valid: func(g *Game) bool { return g.TerrainWeatherMapRowCount >= 0 }},
+	{Name: "PlainTerrainVisionFactor", Ref: func(g *Game) any { return &g.PlainTerrainVisionFactor }},
+	{Name: "PlainTerrainStealthFactor", Ref: func(g *Game) any { return &g.PlainTerrainStealthFactor }},
+	{Name: "PlainTerrainSpeedFactor", Ref: func(g *Game) any { return &g.PlainTerrainSpeedFactor }},
+	{Name: "SwampTerrainVisionFactor", Ref: func(g *Game) any { return &g.SwampTerrainVisionFactor }},
+	{Name: "SwampTerrainStealthFactor", Ref: func(g *Game) any { return &g.SwampTerrainStealthFactor }},
+	{Name: "SwampTerrainSpeedFactor", Ref: func(g *Game) any { return &g.SwampTerrainSpeedFactor }},
+	{Name: "ForestTerrainVisionFactor", Ref: func(g *Game) any { return &g.ForestTerrainVisionFactor }},
+	{Name: "ForestTerrainStealthFactor", Ref: func(g *Game) any { return &g.ForestTerrainStealthFactor }},
+	{Name: "ForestTerrainSpeedFactor", Ref: func(g *Game) any { return &g.ForestTerrainSpeedFactor }},
+	{Name: "ClearWeatherVisionFactor", Ref: func(g *Game) any { return &g.ClearWeatherVisionFactor }},
+	{Name: "ClearWeatherStealthFactor", Ref: func(g *Game) any { return &g.ClearWeatherStealthFactor }},
+	{Name: "ClearWeatherSpeedFactor", Ref: func(g *Game) any { return &g.ClearWeatherSpeedFactor }},
+	{Name: "CloudWeatherVisionFactor", Ref: func(g *Game) any { return &g.CloudWeatherVisionFactor }},
+	{Name: "CloudWeatherStealthFactor", Ref: func(g *Game) any { return &g.CloudWeatherStealthFactor }},
+	{Name: "CloudWeatherSpeedFactor", Ref: func(g *Game) any { return &g.CloudWeatherSpeedFactor }},
+	{Name: "RainWeatherVisionFactor", Ref: func(g *Game) any { return &g.RainWeatherVisionFactor }},
+	{Name: "RainWeatherStealthFactor", Ref: func(g *Game) any { return &g.RainWeatherStealthFactor }},
+	{Name: "RainWeatherSpeedFactor", Ref: func(g *Game) any { return &g.RainWeatherSpeedFactor }},
+	{Name: "VehicleRadius", Ref: func(g *Game) any { return &g.VehicleRadius }},
+	{Name: "TankDurability", Ref: func(g *Game) any { return &g.TankDurability }},
+	{Name: "TankSpeed", Ref: func(g *Game) any { return &g.TankSpeed }},
+	{Name: "TankVisionRange", Ref: func(g *Game) any { return &g.TankVisionRange }},
+	{Name: "TankGroundAttackRange", Ref: func(g *Game) any { return &g.TankGroundAttackRange }},
+	{Name: "TankAerialAttackRange", Ref: func(g *Game) any { return &g.TankAerialAttackRange }},
+	{Name: "TankGroundDamage", Ref: func(g *Game) any { return &g.TankGroundDamage }},
+	{Name: "TankAerialDamage", Ref: func(g *Game) any { return &g.TankAerialDamage }},
+	{Name: "TankGroundDefence", Ref: func(g *Game) any { return &g.TankGroundDefence }},
+	{Name: "TankAerialDefence", Ref: func(g *Game) any { return &g.TankAerialDefence }},
+	{Name: "TankAttackCooldownTicks", Ref: func(g *Game) any { return &g.TankAttackCooldownTicks }},
+	{Name: "TankProductionCost", Ref: func(g *Game) any { return &g.TankProductionCost }},
+	{Name: "IFVDurability", Ref: func(g *Game) any { return &g.IFVDurability }},
+	{Name: "IFVSpeed", Ref: func(g *Game) any { return &g.IFVSpeed }},
+	{Name: "IFVVisionRange", Ref: func(g *Game) any { return &g.IFVVisionRange }},
+	{Name: "IFVGroundAttackRange", Ref: func(g *Game) any { return &g.IFVGroundAttackRange }},
+	{Name: "IFVAerialAttackRange", Ref: func(g *Game) any { return &g.IFVAerialAttackRange }},
+	{Name: "IFVGroundDamage", Ref: func(g *Game) any { return &g.IFVGroundDamage }},
+	{Name: "IFVAerialDamage", Ref: func(g *Game) any { return &g.IFVAerialDamage }},
+	{Name: "IFVGroundDefence", Ref: func(g *Game) any { return &g.IFVGroundDefence }},
+	{Name: "IFVAerialDefence", Ref: func(g *Game) any { return &g.IFVAerialDefence }},
+	{Name: "IFVAttackCooldownTicks", Ref: func(g *Game) any { return &g.IFVAttackCooldownTicks }},
+	{Name: "IFVProductionCost", Ref: func(g *Game) any { return &g.IFVProductionCost }},
+	{Name: "ARRVDurability", Ref: func(g *Game) any { return &g.ARRVDurability }},
+	{Name: "ARRVSpeed", Ref: func(g *Game) any { return &g.ARRVSpeed }},
+	{Name: "ARRVVisionRange", Ref: func(g *Game) any { return &g.ARRVVisionRange }},
+	{Name: "ARRVGroundDefence", Ref: func(g *Game) any { return &g.ARRVGroundDefence }},
+	{Name: "ARRVAerialDefence", Ref: func(g *Game) any { return &g.ARRVAerialDefence }},
+	{Name: "ARRVProductionCost", Ref: func(g *Game) any { return &g.ARRVProductionCost }},
+	{Name: "ARRVRepairRange", Ref: func(g *Game) any { return &g.ARRVRepairRange }},
+	{Name: "ARRVRepairSpeed", Ref: func(g *Game) any { return &g.ARRVRepairSpeed }},
+	{Name: "HelicopterDurability", Ref: func(g *Game) any { return &g.HelicopterDurability }},
+	{Name: "HelicopterSpeed", Ref: func(g *Game) any { return &g.HelicopterSpeed }},
+	{Name: "HelicopterVisionRange", Ref: func(g *Game) any { return &g.HelicopterVisionRange }},
+	{Name: "HelicopterGroundAttackRange", Ref: func(g *Game) any { return &g.HelicopterGroundAttackRange }},
+	{Name: "HelicopterAerialAttackRange", Ref: func(g *Game) any { return &g.HelicopterAerialAttackRange }},
+	{Name: "HelicopterGroundDamage", Ref: func(g *Game) any { return &g.HelicopterGroundDamage }},
+	{Name: "HelicopterAerialDamage", Ref: func(g *Game) any { return &g.HelicopterAerialDamage }},
+	{Name: "HelicopterGroundDefence", Ref: func(g *Game) any { return &g.HelicopterGroundDefence }},
+	{Name: "HelicopterAerialDefence", Ref: func(g *Game) any { return &g.HelicopterAerialDefence }},
+	{Name: "HelicopterAttackCooldownTicks", Ref: func(g *Game) any { return &g.HelicopterAttackCooldownTicks }},
+	{Name: "HelicopterProductionCost", Ref: func(g *Game) any { return &g.HelicopterProductionCost }},
+	{Name: "FighterDurability", Ref: func(g *Game) any { return &g.FighterDurability }},
+	{Name: "FighterSpeed", Ref: func(g *Game) any { return &g.FighterSpeed }},
+	{Name: "FighterVisionRange", Ref: func(g *Game) any { return &g.FighterVisionRange }},
+	{Name: "FighterGroundAttackRange", Ref: func(g *Game) any { return &g.FighterGroundAttackRange }},
+	{Name: "FighterAerialAttackRange", Ref: func(g *Game) any { return &g.FighterAerialAttackRange }},
+	{Name: "FighterGroundDamage", Ref: func(g *Game) any { return &g.FighterGroundDamage }},
+	{Name: "FighterAerialDamage", Ref: func(g *Game) any { return &g.FighterAerialDamage }},
+	{Name: "FighterGroundDefence", Ref: func(g *Game) any { return &g.FighterGroundDefence }},
+	{Name: "FighterAerialDefence", Ref: func(g *Game) any { return &g.FighterAerialDefence }},
+	{Name: "FighterAttackCooldownTicks", Ref: func(g *Game) any { return &g.FighterAttackCooldownTicks }},
+	{Name: "FighterProductionCost", Ref: func(g *Game) any { return &g.FighterProductionCost }},
+	{Name: "MaxFacilityCapturePoints", Ref: func(g *Game) any { return &g.MaxFacilityCapturePoints }},
+	{Name: "FacilityCapturePointsPerVehiclePerTick", Ref: func(g *Game) any { return &g.FacilityCapturePointsPerVehiclePerTick }},
+	{Name: "FacilityWidth", Ref: func(g *Game) any { return &g.FacilityWidth }},
+	{Name: "FacilityHeight", Ref: func(g *Game) any { return &g.FacilityHeight }},
+	{Name: "BaseTacticalNuclearStrikeCooldown", Ref: func(g *Game) any { return &g.BaseTacticalNuclearStrikeCooldown }},
+	{Name: "TacticalNuclearStrikeCooldownDecreasePerControlCenter", Ref: func(g *Game) any { return &g.TacticalNuclearStrikeCooldownDecreasePerControlCenter }},
+	{Name: "TacticalNuclearStrikeMaxDamage", Ref: func(g *Game) any { return &g.TacticalNuclearStrikeMaxDamage }},
+	{Name: "TacticalNuclearStrikeRadius", Ref: func(g *Game) any { return &g.TacticalNuclearStrikeRadius }},
+	{Name: "TacticalNuclearStrikeDelay", Ref: func(g *Game) any { return &g.TacticalNuclearStrikeDelay }},
+}
+
+var WorldSchema = Schema[World]{
+	{Name: "World.TickIndex", Ref: func(w *World) any { return &w.TickIndex }, Valid: func(w *World) bool { return w.TickIndex >= 0 }},
+	{Name: "World.TickCount", Ref: func(w *World) any { return &w.TickCount }, Valid: func(w *World) bool { return w.TickCount >= 0 }},
+	{Name: "World.Width", Ref: func(w *World) any { return &w.Width }, Valid: func(w *World) bool { return extent(w.Width) }},
+	{Name: "World.Height", Ref: func(w *World) any { return &w.Height }, Valid: func(w *World) bool { return extent(w.Height) }},
+	{Name: "World.Players", Ref: func(w *World) any { return &w.Players }},
+	{Name: "World.NewVehicles", Ref: func(w *World) any { return &w.NewVehicles }},
+	{Name: "World.VehicleUpdates", Ref: func(w *World) any { return &w.VehicleUpdates }},
+	{Name: "World.TerrainByCellXY", Ref: func(w *World) any { return &w.TerrainByCellXY }, When: firstTick},
+	{Name: "World.WeatherByCellXY", Ref: func(w *World) any { return &w.WeatherByCellXY }, When: firstTick},
+	{Name: "World.Facilities", Ref: func(w *World) any { return &w.Facilities }},
+}
+
+// firstTick: terrain and weather do not change and are only sent once.
+func firstTick(w *World) bool {
+	return w.TickIndex == 0
+}
+
+// readFields decodes the fields of s into v.
+func readFields[T any](d *Decoder, s Schema[T], v *T) {
+	for i := range s {
+		f := &s[i]
+		if f.When != nil && !f.When(v) {
+			continue
+		}
+
+		offset := d.pos
+		switch p := f.Ref(v).(type) {
+		case *bool:
+			*p = d.readBool(f.Name)
+		case *int:
+			*p = d.readInt(f.Name)
+		case *int64:
+			*p = d.readInt64(f.Name)
+		case *float64:
+			*p = d.readFloat64(f.Name)
+		case *[]*Player:
+			*p = d.readPlayers()
+		case *[]*Vehicle:
+			*p = d.readVehicles()
+		case *[]*VehicleUpdate:
+			*p = d.readVehiclesUpdate(*p)
+		case *[][]Terrain:
+			*p = d.readTerrains()
+		case *[][]Weather:
+			*p = d.readWeather()
+		case *[]*Facility:
+			*p = d.readFacilities()
+		default:
+			panic(fmt.Sprintf("codec: field %s has unsupported type %T", f.Name, p))
+		}
+
+		if d.err != nil {
+			return
+		}
+		if f.Valid != nil && !f.Valid(v) {
+			d.fail(d.msg, f.Name, offset, d.mismatch())
+			return
+		}
+	}
+}
+
+// writeFields encodes the fields of s from v.
+func writeFields[T any](e *Encoder, s Schema[T], v *T) {
+	for i := range s {
+		f := &s[i]
+		if f.When != nil && !f.When(v) {
+			continue
+		}
+
+		switch p := f.Ref(v).(type) {
+		case *bool:
+			e.writeBool(f.Name, *p)
+		case *int:
+			e.writeInt(f.Name, *p)
+		case *int64:
+			e.writeInt64(f.Name, *p)
+		case *float64:
+			e.writeFloat64(f.Name, *p)
+		case *[]*Player:
+			e.writePlayers(*p)
+		case *[]*Vehicle:
+			e.writeVehicles(*p)
+		case *[]*VehicleUpdate:
+			e.writeVehicleUpdates(*p)
+		case *[][]Terrain:
+			e.writeTerrains(*p)
+		case *[][]Weather:
+			e.writeWeather(*p)
+		case *[]*Facility:
+			e.writeFacilities(*p)
+		default:
+			panic(fmt.Sprintf("codec: field %s has unsupported type %T", f.Name, p))
+		}
+	}
+}
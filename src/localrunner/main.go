@@ -0,0 +1,46 @@
+// Command localrunner serves a scripted game to a single strategy, standing
+// in for the Java local-runner.
+package main
+
+import (
+	"flag"
+	"log"
+	"mockserver"
+)
+
+func main() {
+	addr := flag.String("listen", "127.0.0.1:31001", "listen address")
+	token := flag.String("token", "", "expected authentication token")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("usage: localrunner [-listen addr] [-token token] scenario.json")
+	}
+
+	scenario, err := mockserver.LoadScenario(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv, err := mockserver.Listen(*addr, scenario)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Token = *token
+
+	log.Printf("waiting for a strategy on %s", srv.Addr())
+
+	if err := srv.Serve(); err != nil {
+		log.Fatal(err)
+	}
+
+	for tick, moves := range scenario.Received {
+		for i, m := range moves {
+			if m != nil && m.Action != 0 {
+				log.Printf("tick %d, player %d: action %d", tick, i, m.Action)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	. "model"
+	"os"
+)
+
+// Script decides what the mock server sends. Start is called once after the
+// handshake, Tick before every tick and Moves with the replies to it.
+type Script interface {
+	Start() (teamSize int, game *Game)
+	// Tick returns one context per team member, or nil to end the game.
+	Tick(index int) []*PlayerContext
+	Moves(index int, moves []*Move)
+}
+
+// Scenario is a Script replaying a fixed list of ticks. It can be built in
+// Go code or loaded from a JSON file with LoadScenario.
+type Scenario struct {
+	TeamSize int
+	Game     *Game
+	Ticks    [][]*PlayerContext
+
+	// Received collects the moves sent by the client, one slice per tick.
+	Received [][]*Move `json:"-"`
+}
+
+// LoadScenario reads a Scenario from a JSON file in the form of
+// scenarioFile. Rows of terrain and weather are arrays of numbers, or the
+// base64 strings encoding/json writes for them; see README.md for an
+// example.
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file scenarioFile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	s := &Scenario{TeamSize: file.TeamSize, Game: file.Game}
+	if s.TeamSize == 0 {
+		s.TeamSize = 1
+	}
+	for i, tick := range file.Ticks {
+		contexts := make([]*PlayerContext, len(tick))
+		for j, c := range tick {
+			if c.Player == nil || c.World == nil {
+				return nil, fmt.Errorf("%s: tick %d, context %d: Player and World are required", path, i, j)
+			}
+			contexts[j] = &PlayerContext{Player: c.Player, World: c.World}
+		}
+		s.Ticks = append(s.Ticks, contexts)
+	}
+
+	return s, nil
+}
+
+// scenarioFile is the JSON form of a Scenario. Contexts name their Player
+// and World, which PlayerContext embeds and encoding/json would flatten.
+type scenarioFile struct {
+	TeamSize int
+	Game     *Game
+	Ticks    [][]struct {
+		Player *Player
+		World  *World
+	}
+}
+
+func (s *Scenario) Start() (int, *Game) {
+	return s.TeamSize, s.Game
+}
+
+func (s *Scenario) Tick(index int) []*PlayerContext {
+	if index < len(s.Ticks) {
+		return s.Ticks[index]
+	}
+	return nil
+}
+
+func (s *Scenario) Moves(index int, moves []*Move) {
+	s.Received = append(s.Received, moves)
+}
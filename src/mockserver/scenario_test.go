@@ -0,0 +1,54 @@
+package mockserver
+
+import (
+	. "model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestLoadScenario loads the example of README.md, then the same terrain
+// written as encoding/json writes it.
+func TestLoadScenario(t *testing.T) {
+	for _, tc := range []struct {
+		name, terrain string
+	}{
+		{"numbers", `[[0, 1], [2, 0]]`},
+		{"base64", `["AAE=", "AgA="]`},
+	} {
+		path := filepath.Join(t.TempDir(), "scenario.json")
+		data := `{"TeamSize": 1, "Game": {"TickCount": 2, "WorldWidth": 64, "WorldHeight": 64},
+ "Ticks": [
+  [{"Player": {"Id": 1, "Me": true}, "World": {"Players": [{"Id": 1, "Me": true}],
+    "TerrainByCellXY": ` + tc.terrain + `, "WeatherByCellXY": [[0, 0], [1, 2]]}}],
+  [{"Player": {"Id": 1, "Me": true}, "World": {"TickIndex": 1}}]]}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := LoadScenario(path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(s.Ticks) != 2 || len(s.Ticks[0]) != 1 {
+			t.Fatalf("%s: %d ticks loaded", tc.name, len(s.Ticks))
+		}
+		w := s.Ticks[0][0].World
+		if want := [][]Terrain{{Terrain_Plain, Terrain_Swamp}, {Terrain_Forest, Terrain_Plain}}; !reflect.DeepEqual(w.TerrainByCellXY, want) {
+			t.Errorf("%s: terrain %v, want %v", tc.name, w.TerrainByCellXY, want)
+		}
+		if want := [][]Weather{{Weather_Clear, Weather_Clear}, {Weather_Cloud, Weather_Rain}}; !reflect.DeepEqual(w.WeatherByCellXY, want) {
+			t.Errorf("%s: weather %v, want %v", tc.name, w.WeatherByCellXY, want)
+		}
+	}
+
+	// The fields of a context must not be flattened as PlayerContext is.
+	path := filepath.Join(t.TempDir(), "flat.json")
+	if err := os.WriteFile(path, []byte(`{"Ticks": [[{"Id": 1, "Me": true, "TickIndex": 0}]]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScenario(path); err == nil {
+		t.Error("flattened context loaded without error")
+	}
+}
@@ -0,0 +1,101 @@
+package mockserver
+
+import (
+	"codec"
+	"errors"
+	. "model"
+	"net"
+)
+
+var ErrBadToken = errors.New("bad authentication token")
+
+// Server plays the server half of the protocol against a single client.
+type Server struct {
+	Script Script
+	// Token is the expected authentication token; empty accepts any.
+	Token string
+
+	ln net.Listener
+}
+
+func Listen(addr string, script Script) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{Script: script, ln: ln}, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Serve accepts one connection and plays the script over it.
+func (s *Server) Serve() error {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return err
+	}
+	return s.ServeConn(conn)
+}
+
+func (s *Server) ServeConn(nc net.Conn) error {
+	defer nc.Close()
+
+	dec := codec.NewDecoder(nc)
+	enc := codec.NewEncoder(nc)
+
+	token, err := dec.ReadTokenMessage()
+	if err != nil {
+		return err
+	}
+	if s.Token != "" && token != s.Token {
+		return ErrBadToken
+	}
+
+	ver, err := dec.ReadProtocolVersionMessage()
+	if err != nil {
+		return err
+	}
+	if err := dec.SetVersion(ver); err != nil {
+		return err
+	}
+	enc.SetVersion(ver)
+
+	teamSize, game := s.Script.Start()
+
+	enc.WriteTeamSizeMessage(teamSize)
+	enc.WriteGameContextMessage(game)
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+
+	for tick := 0; ; tick++ {
+		contexts := s.Script.Tick(tick)
+		if contexts == nil {
+			break
+		}
+
+		for _, pc := range contexts {
+			enc.WritePlayerContextMessage(pc)
+		}
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+
+		moves := make([]*Move, len(contexts))
+		for i := range moves {
+			if moves[i], err = dec.ReadMoveMessage(); err != nil {
+				return err
+			}
+		}
+		s.Script.Moves(tick, moves)
+	}
+
+	enc.WriteGameOverMessage()
+	return enc.Flush()
+}
+
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
@@ -0,0 +1,84 @@
+package mockserver
+
+import (
+	"client"
+	"context"
+	. "model"
+	"net"
+	"testing"
+)
+
+// follower selects everything on the first tick and then moves towards the
+// x coordinate of its only vehicle, so the moves depend on what it received.
+type follower struct{}
+
+func (follower) Move(me *Player, world *World, game *Game, move *Move) {
+	if world.TickIndex == 0 {
+		move.Action = Action_ClearAndSelect
+		move.Right, move.Bottom = world.Width, world.Height
+		return
+	}
+	for _, u := range world.VehicleUpdates {
+		move.Action = Action_Move
+		move.X = u.X
+	}
+}
+
+func TestRunAgainstScenario(t *testing.T) {
+	me := &Player{Id: 1, Me: true}
+	scenario := &Scenario{
+		TeamSize: 1,
+		Game:     &Game{TickCount: 3, WorldWidth: 1024, WorldHeight: 1024},
+		Ticks: [][]*PlayerContext{
+			{{Player: me, World: &World{TickIndex: 0, Width: 1024, Height: 1024, Players: []*Player{me},
+				NewVehicles: []*Vehicle{{CircularUnit: CircularUnit{Unit: Unit{Id: 7, X: 10, Y: 20}}, PlayerId: 1}}}}},
+			{{Player: me, World: &World{TickIndex: 1, Players: []*Player{me},
+				VehicleUpdates: []*VehicleUpdate{{Id: 7, X: 15, Y: 20}}}}},
+			{{Player: me, World: &World{TickIndex: 2, Players: []*Player{me},
+				VehicleUpdates: []*VehicleUpdate{{Id: 7, X: 30, Y: 20}}}}},
+		},
+	}
+
+	srv, err := Listen("127.0.0.1:0", scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve() }()
+
+	opts := client.DefaultOptions()
+	opts.Host, opts.Port, _ = net.SplitHostPort(srv.Addr().String())
+	opts.LogLevel = client.LogQuiet
+
+	if err := client.Run(context.Background(), follower{}, opts); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	if len(scenario.Received) != 3 {
+		t.Fatalf("received moves for %d ticks, want 3", len(scenario.Received))
+	}
+	want := []struct {
+		action ActionType
+		x      float64
+	}{
+		{Action_ClearAndSelect, 0},
+		{Action_Move, 15},
+		{Action_Move, 30},
+	}
+	for tick, moves := range scenario.Received {
+		if len(moves) != 1 {
+			t.Fatalf("tick %d: %d moves, want 1", tick, len(moves))
+		}
+		if m := moves[0]; m.Action != want[tick].action || m.X != want[tick].x {
+			t.Errorf("tick %d: got action %v x %v, want action %v x %v", tick, m.Action, m.X, want[tick].action, want[tick].x)
+		}
+	}
+	if m := scenario.Received[0][0]; m.Right != 1024 || m.Bottom != 1024 {
+		t.Errorf("tick 0: selection %+v does not cover the world", *m)
+	}
+}
@@ -1,5 +1,7 @@
 package model
 
+import "context"
+
 /**
  * Стратегия --- интерфейс, содержащий описание методов искусственного интеллекта армии.
  * Каждая пользовательская стратегия должна реализовывать этот интерфейс.
@@ -16,3 +18,40 @@ type Strategy interface {
 	*/
 	Move(*Player, *World, *Game, *Move)
 }
+
+/**
+ * Необязательный интерфейс стратегии. Если стратегия его реализует, метод вызывается
+ * один раз после получения игровых констант, до первого вызова {@code Move}.
+ *
+ * game     Различные игровые константы.
+ * teamSize Количество игроков, которыми управляет стратегия.
+ */
+type GameStarter interface {
+	Start(game *Game, teamSize int)
+}
+
+/**
+ * Необязательный интерфейс стратегии. Если стратегия его реализует, метод вызывается
+ * один раз после окончания игры, в том числе прерванной разрывом соединения или
+ * ошибкой протокола.
+ *
+ * world  Последнее полученное состояние мира, неполное, если его не удалось прочитать.
+ * scores Итоговое количество баллов игроков по их идентификаторам.
+ */
+type GameEnder interface {
+	End(world *World, scores map[int64]int)
+}
+
+/**
+ * Необязательный интерфейс стратегии. Если стратегия его реализует, в каждом тике вместо
+ * {@code Move} вызывается этот метод. Контекст отменяется, когда ход больше не нужен:
+ * истёк бюджет времени на тик или игра прерывается, --- так долгие вычисления могут
+ * остановиться досрочно. {@code Move} по-прежнему вызывается там, где контекста нет,
+ * например при воспроизведении записи.
+ *
+ * ctx Контекст текущего тика, действительный до возврата из метода.
+ * Остальные параметры совпадают с {@code Move}.
+ */
+type ContextMover interface {
+	MoveContext(ctx context.Context, me *Player, world *World, game *Game, move *Move)
+}
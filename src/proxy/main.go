@@ -0,0 +1,216 @@
+// Command proxy sits between a bot and the local-runner: the bot connects
+// to the proxy as if it were the runner, and every message is forwarded to
+// the other side once decoded. The game can be saved as a session file and
+// the moves of the bot are logged, so sparring partners written in any
+// language can be studied without touching them.
+package main
+
+import (
+	"bytes"
+	"client"
+	"codec"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	. "model"
+	"net"
+	"sync"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:31001", "address the bot connects to")
+	upstream := flag.String("upstream", "127.0.0.1:31002", "address of the local-runner")
+	record := flag.String("record", "", "save the game to the session `file`")
+	moves := flag.Bool("moves", true, "log the moves of the bot")
+	flag.Parse()
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("waiting for a bot on %s", ln.Addr())
+
+	bot, err := ln.Accept()
+	ln.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer bot.Close()
+
+	runner, err := net.Dial("tcp", *upstream)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer runner.Close()
+
+	p := &proxy{logMoves: *moves, tick: -1}
+	if *record != "" {
+		if p.rec, err = client.CreateRecorder(*record); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err = p.run(bot, runner)
+	if p.rec != nil {
+		if cerr := p.rec.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Print("game over")
+}
+
+type proxy struct {
+	logMoves bool
+
+	// mu guards the recorder and the tick, shared by both directions.
+	mu   sync.Mutex
+	rec  *client.Recorder
+	tick int
+}
+
+// direction is one half of the connection: messages decoded from the
+// source are forwarded to dst as soon as they are complete.
+type direction struct {
+	p    *proxy
+	kind client.RecordKind
+	dec  *codec.Decoder
+	dst  io.Writer
+	buf  bytes.Buffer
+
+	// index counts the moves of the current tick, to tell team members
+	// apart.
+	tick, index int
+}
+
+func (p *proxy) newDirection(src io.Reader, dst io.Writer, kind client.RecordKind) *direction {
+	d := &direction{p: p, kind: kind, dec: codec.NewDecoder(src), dst: dst, tick: -1}
+	d.dec.SetTap(&d.buf)
+	return d
+}
+
+func (p *proxy) run(bot, runner net.Conn) error {
+	up := p.newDirection(bot, runner, client.Record_Write)
+	down := p.newDirection(runner, bot, client.Record_Read)
+
+	// The version announced by the bot decides the layout of what the
+	// runner sends, so the handshake is read before both directions run.
+	for _, want := range []codec.MessageType{codec.Message_AuthenticationToken, codec.Message_ProtocolVersion} {
+		m, v, err := up.next()
+		if err != nil {
+			return err
+		}
+		if m != want {
+			return errors.New("bot sent " + m.String() + " instead of " + want.String())
+		}
+		if m == codec.Message_ProtocolVersion {
+			if err := down.dec.SetVersion(v.(int)); err != nil {
+				return err
+			}
+			log.Printf("bot speaks protocol version %d", v)
+		}
+	}
+
+	errc := make(chan error, 2)
+	go func() { errc <- up.pump() }()
+	go func() { errc <- down.pump() }()
+
+	// Whichever side finishes first ends the game for the other one.
+	err := <-errc
+	bot.Close()
+	runner.Close()
+	<-errc
+	return err
+}
+
+// pump forwards messages until the game is over or the source closes.
+func (d *direction) pump() error {
+	for {
+		m, v, err := d.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch m {
+		case codec.Message_GameOver:
+			return nil
+		case codec.Message_Move:
+			d.logMove(v.(*Move))
+		}
+	}
+}
+
+// next reads one message, records it and forwards it. Bytes of a message
+// that fails to decode are still forwarded, so the peer sees the same
+// stream the proxy did.
+func (d *direction) next() (codec.MessageType, any, error) {
+	m, v, err := d.dec.ReadMessage()
+	defer d.buf.Reset()
+
+	if err == nil {
+		if pc, ok := v.(*PlayerContext); ok && pc.World != nil {
+			d.p.setTick(pc.World.TickIndex)
+		}
+		if rerr := d.p.record(d.kind, d.buf.Bytes()); rerr != nil {
+			return m, v, rerr
+		}
+	}
+	if d.buf.Len() > 0 {
+		if _, werr := d.dst.Write(d.buf.Bytes()); err == nil {
+			err = werr
+		}
+	}
+	return m, v, err
+}
+
+func (d *direction) logMove(m *Move) {
+	if tick := d.p.currentTick(); tick != d.tick {
+		d.tick, d.index = tick, 0
+	}
+	if d.p.logMoves && m != nil && m.Action != Action_None {
+		log.Printf("tick %d, player %d: %+v", d.tick, d.index, *m)
+	}
+	d.index++
+}
+
+// setTick records a marker when a context starts a new tick; the contexts
+// of a team share one.
+func (p *proxy) setTick(tick int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if tick != p.tick {
+		p.tick = tick
+		if p.rec != nil {
+			p.rec.Tick(tick)
+		}
+	}
+}
+
+func (p *proxy) currentTick() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tick
+}
+
+func (p *proxy) record(kind client.RecordKind, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rec == nil {
+		return nil
+	}
+	if err := p.rec.Record(kind, payload); err != nil {
+		return err
+	}
+	if kind == client.Record_Write {
+		return p.rec.Flush()
+	}
+	return nil
+}
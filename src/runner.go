@@ -1,7 +1,19 @@
 package main
 
-import ."client"
+import (
+	. "client"
+	"model"
+)
 
+func newStrategy() model.Strategy {
+	return New()
+}
+
+func init() {
+	Register("mystrategy", newStrategy)
+}
+
+// main plays one MyStrategy per player, so that team formats work as well.
 func main() {
-	Start(New())
-}
\ No newline at end of file
+	StartTeam(newStrategy)
+}